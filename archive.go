@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// archiveMaxBackoff bounds the time between attempts to upload a log
+	// file.
+	archiveMaxBackoff = 5 * time.Minute
+	// archiveCloseTimeout bounds how long uploading the open log files may
+	// take when the store is closed.
+	archiveCloseTimeout = 30 * time.Second
+)
+
+// An archive is where log files are uploaded to once they are finished.
+type archive interface {
+	// upload uploads the file as key, which is its name relative to the
+	// log directory, with forward slashes.
+	upload(ctx context.Context, key, name string) error
+	String() string
+}
+
+// uploadMarker is created next to a finished log file until it's uploaded,
+// so that uploads that didn't happen are resumed after a restart. name is the
+// name of the log file before it was compressed with gzip.
+func uploadMarker(name string) string {
+	return name + ".upload"
+}
+
+// finish is called once a log file was rotated out. In the background, it
+// compresses the file if gzip is enabled, and uploads it if an archive is
+// configured.
+func (fs *fileStore) finish(name string) {
+	if fs.opts.Compress != CompressGzip && fs.opts.Archive == nil {
+		return
+	}
+	if fs.opts.Archive != nil {
+		f, err := os.OpenFile(uploadMarker(name), os.O_WRONLY|os.O_CREATE, fs.opts.FileMode)
+		if err != nil {
+			log.Println("error marking log file for upload:", err)
+		} else {
+			f.Close()
+		}
+	}
+	fs.finishing.Add(1)
+	go func() {
+		defer fs.finishing.Done()
+		if err := fs.finishFile(name); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+func (fs *fileStore) finishFile(name string) error {
+	marker := uploadMarker(name)
+	if fs.opts.Compress == CompressGzip {
+		// The original is gone if it was compressed before a restart.
+		if _, err := os.Stat(name); err == nil {
+			if err := gzipFile(name, fs.opts.FileMode); err != nil {
+				return fmt.Errorf("error compressing log file: %w", err)
+			}
+		}
+		name += ".gz"
+	}
+	if fs.opts.Archive == nil {
+		return nil
+	}
+	if err := fs.upload(name); err != nil {
+		return err
+	}
+	if fs.opts.DeleteArchived {
+		if err := os.Remove(name); err != nil {
+			log.Println("error removing uploaded log file:", err)
+		}
+	}
+	return os.Remove(marker)
+}
+
+// upload uploads the log file, retrying with backoff until it succeeds or the
+// store is closed.
+func (fs *fileStore) upload(name string) error {
+	key, err := filepath.Rel(fs.path, name)
+	if err != nil {
+		return err
+	}
+	key = filepath.ToSlash(key)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-fs.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	backoff := time.Second
+	for {
+		err := fs.opts.Archive.upload(ctx, key, name)
+		if err == nil {
+			log.Printf("uploaded %s to %s", key, fs.opts.Archive)
+			return nil
+		}
+		log.Printf("error uploading %s, retrying in %s: %v", key, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.New("gave up uploading " + key + ", it will be retried after a restart")
+		}
+		backoff = min(backoff*2, archiveMaxBackoff)
+	}
+}
+
+// resumeUploads finishes the log files that were rotated out but not uploaded
+// before the last restart.
+func (fs *fileStore) resumeUploads() {
+	filepath.WalkDir(fs.path, func(name string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(name, ".upload") {
+			return nil
+		}
+		name = strings.TrimSuffix(name, ".upload")
+		fs.finishing.Add(1)
+		go func() {
+			defer fs.finishing.Done()
+			if err := fs.finishFile(name); err != nil {
+				log.Println(err)
+			}
+		}()
+		return nil
+	})
+}
+
+// uploadOpen makes a single attempt at uploading the log files that were open,
+// which are kept since they are continued after a restart. They're uploaded
+// again once they are rotated out. It must be called with fs.mu held, after
+// the files were closed.
+func (fs *fileStore) uploadOpen(names []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), archiveCloseTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := filepath.Rel(fs.path, name)
+			if err == nil {
+				err = fs.opts.Archive.upload(ctx, filepath.ToSlash(key), name)
+			}
+			if err != nil {
+				log.Printf("error uploading %s: %v", name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
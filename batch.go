@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// batcher buffers records and hands them to commit in batches, whenever a
+// batch is full or the interval passed. It's used by the stores that are
+// slow to write a single record.
+//
+// A batch that fails to be committed is kept, and committed again along with
+// the records after it. Until that works, Append turns records away with the
+// error, so that the writers hold on to them instead.
+type batcher struct {
+	size     int
+	interval time.Duration
+	commit   func([]Record) error
+
+	mu    sync.Mutex
+	batch []Record
+	// err is the error of the last commit, if it failed.
+	err error
+	// full is signaled when the batch reaches size.
+	full chan struct{}
+	// done is closed when the batcher is closed, and closed is closed once
+	// the last batch was committed after that.
+	done   chan struct{}
+	closed chan struct{}
+}
+
+func newBatcher(size int, interval time.Duration, commit func([]Record) error) *batcher {
+	b := &batcher{
+		size:     size,
+		interval: interval,
+		commit:   commit,
+		full:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go b.commitLoop()
+	return b
+}
+
+func (b *batcher) Append(r Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return fmt.Errorf("error writing entries: %w", b.err)
+	}
+	b.batch = append(b.batch, r)
+	if len(b.batch) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close commits what's left and waits for it. It returns the error of the
+// last commit if the records couldn't all be committed.
+func (b *batcher) Close() error {
+	close(b.done)
+	<-b.closed
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return fmt.Errorf("error writing %d entries: %w", len(b.batch), b.err)
+	}
+	return nil
+}
+
+func (b *batcher) commitLoop() {
+	defer close(b.closed)
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-b.full:
+		case <-b.done:
+			b.commitAll()
+			return
+		}
+		b.commitAll()
+	}
+}
+
+// commitAll commits the records in batches of at most size. If one of them
+// fails, it and the records after it are put back in front of the ones that
+// were appended in the meantime.
+func (b *batcher) commitAll() {
+	b.mu.Lock()
+	batch := b.batch
+	b.batch = nil
+	b.mu.Unlock()
+	var err error
+	for len(batch) > 0 {
+		n := min(len(batch), b.size)
+		if err = b.commit(batch[:n]); err != nil {
+			break
+		}
+		batch = batch[n:]
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil && b.err == nil {
+		log.Printf("error writing entries, retrying %d of them: %v", len(batch), err)
+	} else if err == nil && b.err != nil {
+		log.Println("writing entries works again")
+	}
+	b.err = err
+	b.batch = append(batch, b.batch...)
+}
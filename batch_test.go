@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// flakyCommit commits records to a list, or fails while broken is set.
+type flakyCommit struct {
+	mu        sync.Mutex
+	broken    bool
+	committed []discord.GuildID
+}
+
+var errBroken = errors.New("broken")
+
+func (c *flakyCommit) commit(records []Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return errBroken
+	}
+	for _, r := range records {
+		c.committed = append(c.committed, r.Guild)
+	}
+	return nil
+}
+
+func (c *flakyCommit) setBroken(broken bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.broken = broken
+}
+
+// waitFor fails the test if cond doesn't become true within a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting until", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBatcherRetriesFailedBatch(t *testing.T) {
+	c := &flakyCommit{broken: true}
+	b := newBatcher(2, 10*time.Millisecond, c.commit)
+	b.Append(Record{Guild: 1})
+	b.Append(Record{Guild: 2})
+	waitFor(t, "the batch failed to be committed", func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.err != nil
+	})
+	if err := b.Append(Record{Guild: 3}); !errors.Is(err, errBroken) {
+		t.Errorf("Append failed with %v, want %v", err, errBroken)
+	}
+	c.setBroken(false)
+	waitFor(t, "Append works again", func() bool {
+		return b.Append(Record{Guild: 3}) == nil
+	})
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The records that failed to be committed are committed once, and the
+	// one that was turned away isn't there.
+	want := []discord.GuildID{1, 2, 3}
+	if !slices.Equal(c.committed, want) {
+		t.Errorf("committed %v, want %v", c.committed, want)
+	}
+}
+
+func TestBatcherCloseError(t *testing.T) {
+	c := &flakyCommit{broken: true}
+	b := newBatcher(10, time.Hour, c.commit)
+	b.Append(Record{Guild: 1})
+	if err := b.Close(); !errors.Is(err, errBroken) {
+		t.Errorf("Close returned %v, want %v", err, errBroken)
+	}
+}
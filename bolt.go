@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltBatchSize is how many entries are written per transaction at most.
+	boltBatchSize = 500
+	// boltFlushInterval is how often buffered entries are committed.
+	// Entries that weren't committed yet are lost if the process dies.
+	boltFlushInterval = time.Second
+)
+
+// boltStore writes entries to a bbolt database, with a bucket per guild. The
+// keys are the entry's time in nanoseconds since the Unix epoch followed by
+// the bucket's sequence number, both big-endian, so that they sort by time.
+// The values are the entries as JSON.
+type boltStore struct {
+	*batcher
+	db *bolt.DB
+}
+
+func openBoltStore(name string, dirMode, fileMode os.FileMode) (*boltStore, error) {
+	err := os.MkdirAll(filepath.Dir(name), dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+	db, err := bolt.Open(name, fileMode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	s := &boltStore{db: db}
+	s.batcher = newBatcher(boltBatchSize, boltFlushInterval, s.put)
+	return s, nil
+}
+
+func (s *boltStore) Close() error {
+	return errors.Join(s.batcher.Close(), s.db.Close())
+}
+
+func (s *boltStore) put(records []Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, r := range records {
+			b, err := tx.CreateBucketIfNotExists([]byte(r.Guild.String()))
+			if err != nil {
+				return err
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			v, err := json.Marshal(r.Entry)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(boltKey(r.Entry.Time, seq), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func boltKey(t time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// dump implements the dump subcommand, which writes the entries in a bbolt
+// database to stdout as ndjson, guild by guild in time order. The database
+// can't be read while dislog is writing to it.
+func dump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	name := fs.String("db", filepath.Join("dislog", "dislog.bolt"), "the database to dump")
+	guild := fs.Uint64("guild", 0, "only dump this guild's entries")
+	from := fs.String("from", "", "only dump entries from this time on (RFC 3339)")
+	to := fs.String("to", "", "only dump entries before this time (RFC 3339)")
+	fs.Parse(args)
+
+	var start, end []byte
+	if *from != "" {
+		t, err := time.Parse(time.RFC3339, *from)
+		if err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+		start = boltKey(t, 0)
+	}
+	if *to != "" {
+		t, err := time.Parse(time.RFC3339, *to)
+		if err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+		end = boltKey(t, 0)
+	}
+
+	db, err := bolt.Open(*name, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer db.Close()
+	w := bufio.NewWriter(os.Stdout)
+	var buf bytes.Buffer
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(gid []byte, b *bolt.Bucket) error {
+			if *guild != 0 && string(gid) != discord.GuildID(*guild).String() {
+				return nil
+			}
+			c := b.Cursor()
+			k, v := c.First()
+			if start != nil {
+				k, v = c.Seek(start)
+			}
+			for ; k != nil; k, v = c.Next() {
+				if end != nil && bytes.Compare(k, end) >= 0 {
+					break
+				}
+				var e Entry
+				if json.Unmarshal(v, &e) == nil && normalize(&e) {
+					buf.Reset()
+					if err := encodeJSON(&buf, e); err != nil {
+						return err
+					}
+					w.Write(buf.Bytes())
+					continue
+				}
+				w.Write(v)
+				w.WriteByte('\n')
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
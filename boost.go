@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// logGuildBoost logs changes to the guild's boost count and tier.
+func (l *Logger) logGuildBoost(prev, g discord.Guild) {
+	if prev.NitroBoost == g.NitroBoost && prev.NitroBoosters == g.NitroBoosters {
+		return
+	}
+	entry := GuildBoostEntry{
+		Tier:      int(g.NitroBoost),
+		OldTier:   int(prev.NitroBoost),
+		Boosts:    g.NitroBoosters,
+		OldBoosts: prev.NitroBoosters,
+	}
+	err := l.appendEntry(g.ID, EntryGuildBoost, entry)
+	if err != nil {
+		log.Println("error while logging guild boost:", err)
+	}
+}
+
+// logMemberBoost logs members starting or stopping to boost the guild, going
+// by them getting or losing the guild's booster role.
+//
+// Member update events don't say since when the member is boosting, and
+// arikawa can't decode the role tag that marks the booster role, which is
+// always null. The booster role is the only managed role that doesn't belong
+// to a bot or an integration, so that is used to find it instead.
+func (l *Logger) logMemberBoost(gid discord.GuildID, user User, added, removed []discord.RoleID) {
+	var boosting bool
+	switch {
+	case l.isBoosterRole(gid, added):
+		boosting = true
+	case l.isBoosterRole(gid, removed):
+		boosting = false
+	default:
+		return
+	}
+	entry := BoostEntry{
+		User:     user,
+		Boosting: boosting,
+	}
+	err := l.appendEntry(gid, EntryBoost, entry)
+	if err != nil {
+		log.Println("error while logging member boost:", err)
+	}
+}
+
+// isBoosterRole returns whether any of the roles is the guild's booster role.
+func (l *Logger) isBoosterRole(gid discord.GuildID, roles []discord.RoleID) bool {
+	for _, id := range roles {
+		r, err := l.s.Cabinet.Role(gid, id)
+		if err != nil {
+			continue
+		}
+		if r.Managed && !r.Tags.BotID.IsValid() && !r.Tags.IntegrationID.IsValid() {
+			return true
+		}
+	}
+	return false
+}
+
+// GuildBoostEntry is written when the guild's number of boosts or its boost
+// tier changes.
+type GuildBoostEntry struct {
+	Tier      int    `json:"tier"`
+	OldTier   int    `json:"oldTier"`
+	Boosts    uint64 `json:"boosts"`
+	OldBoosts uint64 `json:"oldBoosts"`
+}
+
+// BoostEntry is written when a member starts or stops boosting the guild.
+type BoostEntry struct {
+	User     User `json:"user"`
+	Boosting bool `json:"boosting"`
+}
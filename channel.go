@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+func (l *Logger) logChannelCreateEvent(c *gateway.ChannelCreateEvent) {
+	err := l.appendEntry(c.GuildID, EntryChannel, toChannelEntry(c.Channel, ActionCreate))
+	if err != nil {
+		log.Println("error while logging ChannelCreateEvent:", err)
+	}
+}
+
+func (l *Logger) logChannelUpdateEvent(c *gateway.ChannelUpdateEvent) {
+	entry := toChannelEntry(c.Channel, ActionUpdate)
+	if prev, ok := l.previous(c).(*discord.Channel); ok {
+		entry.OldName = &prev.Name
+		entry.OldTopic = &prev.Topic
+		entry.Overwrites = l.diffOverwrites(c.GuildID, prev.Overwrites, c.Overwrites)
+		if prev.ParentID != c.ParentID {
+			l.logChannelMove(c.Channel, prev.ParentID)
+		}
+		if prev.UserRateLimit != c.UserRateLimit {
+			l.logSlowmode(c.Channel, prev.UserRateLimit)
+		}
+	}
+	err := l.appendEntry(c.GuildID, EntryChannel, entry)
+	if err != nil {
+		log.Println("error while logging ChannelUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logChannelDeleteEvent(c *gateway.ChannelDeleteEvent) {
+	err := l.appendEntry(c.GuildID, EntryChannel, toChannelEntry(c.Channel, ActionDelete))
+	if err != nil {
+		log.Println("error while logging ChannelDeleteEvent:", err)
+	}
+}
+
+func (l *Logger) logChannelPinsUpdateEvent(p *gateway.ChannelPinsUpdateEvent) {
+	entry := PinsEntry{
+		Channel: l.toChannel(p.ChannelID),
+		LastPin: optionalTimestamp(p.LastPin),
+	}
+	if l.opts.Enrich {
+		l.enrich(p.GuildID, EntryPins, func(s *state.State) interface{} {
+			// Bypass the state, which doesn't keep track of pins.
+			pins, err := s.Client.PinnedMessages(p.ChannelID)
+			if err != nil {
+				log.Println("error while fetching pinned messages:", err)
+				return entry
+			}
+			entry.Pinned = make([]PinnedMessage, len(pins))
+			for i, m := range pins {
+				entry.Pinned[i] = PinnedMessage{
+					ID:     m.ID,
+					Author: toUser(m.Author),
+				}
+			}
+			return entry
+		})
+		return
+	}
+	err := l.appendEntry(p.GuildID, EntryPins, entry)
+	if err != nil {
+		log.Println("error while logging ChannelPinsUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logChannelMove(ch discord.Channel, from discord.ChannelID) {
+	entry := ChannelMoveEntry{
+		Channel: Channel{ID: ch.ID, Name: ch.Name},
+		From:    l.category(from),
+		To:      l.category(ch.ParentID),
+	}
+	err := l.appendEntry(ch.GuildID, EntryChannelMove, entry)
+	if err != nil {
+		log.Println("error while logging channel move:", err)
+	}
+}
+
+func (l *Logger) logSlowmode(ch discord.Channel, old discord.Seconds) {
+	entry := SlowmodeEntry{
+		Channel: Channel{ID: ch.ID, Name: ch.Name},
+		Old:     int(old),
+		New:     int(ch.UserRateLimit),
+	}
+	err := l.appendEntry(ch.GuildID, EntrySlowmode, entry)
+	if err != nil {
+		log.Println("error while logging slowmode change:", err)
+	}
+}
+
+// category returns nil for channels that aren't in a category.
+func (l *Logger) category(id discord.ChannelID) *Channel {
+	if !id.IsValid() {
+		return nil
+	}
+	ch := l.toChannel(id)
+	return &ch
+}
+
+func toChannelEntry(ch discord.Channel, action Action) ChannelEntry {
+	return ChannelEntry{
+		ID:     ch.ID,
+		Action: action,
+		Type:   channelTypeName(ch.Type),
+		Name:   ch.Name,
+		Topic:  ch.Topic,
+	}
+}
+
+func channelTypeName(t discord.ChannelType) string {
+	switch t {
+	case discord.GuildText:
+		return "text"
+	case discord.DirectMessage:
+		return "dm"
+	case discord.GuildVoice:
+		return "voice"
+	case discord.GroupDM:
+		return "groupdm"
+	case discord.GuildCategory:
+		return "category"
+	case discord.GuildAnnouncement:
+		return "news"
+	case discord.GuildStore:
+		return "store"
+	case discord.GuildAnnouncementThread:
+		return "newsthread"
+	case discord.GuildPublicThread:
+		return "publicthread"
+	case discord.GuildPrivateThread:
+		return "privatethread"
+	case discord.GuildStageVoice:
+		return "stage"
+	case discord.GuildDirectory:
+		return "directory"
+	case discord.GuildForum:
+		return "forum"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// ChannelMoveEntry is written when a channel is moved to another category.
+// From and To are null for no category.
+type ChannelMoveEntry struct {
+	Channel Channel  `json:"channel"`
+	From    *Channel `json:"from"`
+	To      *Channel `json:"to"`
+}
+
+// SlowmodeEntry is written when a channel's slowmode changes. Old and New are
+// in seconds, and 0 means slowmode is off.
+type SlowmodeEntry struct {
+	Channel Channel `json:"channel"`
+	Old     int     `json:"old"`
+	New     int     `json:"new"`
+}
+
+// PinsEntry is written when a message is pinned or unpinned. LastPin is the
+// time the most recent remaining pin was made, if any are left. Pinned is only
+// set if enrichment is enabled and fetching the pins succeeded.
+type PinsEntry struct {
+	Channel Channel            `json:"channel"`
+	LastPin *discord.Timestamp `json:"lastPin,omitempty"`
+	Pinned  []PinnedMessage    `json:"pinned,omitempty"`
+}
+
+type PinnedMessage struct {
+	ID     discord.MessageID `json:"id"`
+	Author User              `json:"author"`
+}
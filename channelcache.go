@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+const (
+	// channelCacheSize bounds how many channel names are cached.
+	channelCacheSize = 8192
+	// channelFetchTimeout bounds the REST calls made by fetchChannel.
+	channelFetchTimeout = 5 * time.Second
+	// channelFetchBackoff is how long fetchChannel waits before looking
+	// up a channel again after the lookup failed.
+	channelFetchBackoff = time.Minute
+)
+
+// channelNames caches the names of channels, so that toChannel doesn't look
+// up the channel of every message. Names are filled in on the first lookup,
+// and kept up to date by the channel and thread events. It's safe for
+// concurrent use.
+type channelNames struct {
+	mu    sync.Mutex
+	names map[discord.ChannelID]string
+	// fetching holds the channels that fetchChannel is looking up, and
+	// failed holds when the lookups that failed were made. It's bounded by
+	// channelCacheSize like names.
+	fetching map[discord.ChannelID]bool
+	failed   map[discord.ChannelID]time.Time
+}
+
+func (c *channelNames) get(id discord.ChannelID) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	name, ok := c.names[id]
+	return name, ok
+}
+
+// set caches the channel's name. If the cache is full, an arbitrary channel
+// is evicted to make room.
+func (c *channelNames) set(id discord.ChannelID, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names == nil {
+		c.names = make(map[discord.ChannelID]string)
+	}
+	if _, ok := c.names[id]; !ok && len(c.names) >= channelCacheSize {
+		for evicted := range c.names {
+			delete(c.names, evicted)
+			break
+		}
+	}
+	c.names[id] = name
+}
+
+func (c *channelNames) remove(id discord.ChannelID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.names, id)
+}
+
+// update applies the event to the cache, if it's about a channel.
+func (c *channelNames) update(e interface{}) {
+	switch e := e.(type) {
+	case *gateway.ChannelCreateEvent:
+		c.set(e.ID, e.Name)
+	case *gateway.ChannelUpdateEvent:
+		c.set(e.ID, e.Name)
+	case *gateway.ChannelDeleteEvent:
+		c.remove(e.ID)
+	case *gateway.ThreadCreateEvent:
+		c.set(e.ID, e.Name)
+	case *gateway.ThreadUpdateEvent:
+		c.set(e.ID, e.Name)
+	case *gateway.ThreadDeleteEvent:
+		c.remove(e.ID)
+	}
+}
+
+// fetchChannel looks up the channel over REST in the background, and caches
+// its name for the entries after it. Only one lookup of a channel is made at
+// a time, and none within channelFetchBackoff of one that failed.
+func (l *Logger) fetchChannel(id discord.ChannelID) {
+	if !id.IsValid() {
+		return
+	}
+	c := &l.channels
+	c.mu.Lock()
+	if c.fetching[id] || time.Since(c.failed[id]) < channelFetchBackoff {
+		c.mu.Unlock()
+		return
+	}
+	if c.fetching == nil {
+		c.fetching = make(map[discord.ChannelID]bool)
+	}
+	c.fetching[id] = true
+	c.mu.Unlock()
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), channelFetchTimeout)
+		defer cancel()
+		ch, err := l.s.WithContext(ctx).Channel(id)
+		if err == nil {
+			c.set(id, ch.Name)
+		}
+		c.mu.Lock()
+		delete(c.fetching, id)
+		if err != nil {
+			c.fail(id)
+		} else {
+			delete(c.failed, id)
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// fail records that looking up the channel failed. c.mu must be held.
+func (c *channelNames) fail(id discord.ChannelID) {
+	if c.failed == nil {
+		c.failed = make(map[discord.ChannelID]time.Time)
+	}
+	if _, ok := c.failed[id]; !ok && len(c.failed) >= channelCacheSize {
+		for evicted := range c.failed {
+			delete(c.failed, evicted)
+			break
+		}
+	}
+	c.failed[id] = time.Now()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/httputil/httpdriver"
+)
+
+// hungTransport holds every request until release is closed, and then
+// answers that the channel doesn't exist.
+type hungTransport struct {
+	requests atomic.Int32
+	release  chan struct{}
+}
+
+func (h *hungTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.requests.Add(1)
+	select {
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-h.release:
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"code":10003,"message":"Unknown Channel"}`)),
+			Request:    req,
+		}, nil
+	}
+}
+
+func TestHungChannelLookup(t *testing.T) {
+	l, st := newTestLogger(t, Options{})
+	hung := &hungTransport{release: make(chan struct{})}
+	l.s.Client.Client.Client = httpdriver.WrapClient(http.Client{Transport: hung})
+
+	ev := testMessage(1, 10)
+	ev.ChannelID = 200
+	done := make(chan struct{})
+	go func() {
+		l.HandleEvent(ev)
+		ev := testMessage(1, 11)
+		ev.ChannelID = 200
+		l.HandleEvent(ev)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("HandleEvent waited for the channel to be looked up")
+	}
+	close(hung.release)
+	l.Close()
+
+	if n := hung.requests.Load(); n != 1 {
+		t.Errorf("the channel was looked up %d times, want once", n)
+	}
+	entries := st.entries(EntryMessage)
+	if len(entries) != 2 {
+		t.Fatalf("got %d msg entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		var m MessageEntry
+		if err := json.Unmarshal(e.Data, &m); err != nil {
+			t.Fatal(err)
+		}
+		if m.Channel != (Channel{ID: 200}) {
+			t.Errorf("entry has channel %+v, want only its ID", m.Channel)
+		}
+	}
+}
+
+func TestFailedChannelLookupBacksOff(t *testing.T) {
+	l, _ := newTestLogger(t, Options{})
+	failing := &hungTransport{release: make(chan struct{})}
+	close(failing.release)
+	l.s.Client.Client.Client = httpdriver.WrapClient(http.Client{Transport: failing})
+
+	for id := discord.MessageID(10); id < 13; id++ {
+		ev := testMessage(1, id)
+		ev.ChannelID = 200
+		l.HandleEvent(ev)
+		waitFor(t, "the channel was looked up", func() bool {
+			l.channels.mu.Lock()
+			defer l.channels.mu.Unlock()
+			return !l.channels.fetching[200]
+		})
+	}
+	l.Close()
+	if n := failing.requests.Load(); n != 1 {
+		t.Errorf("the channel was looked up %d times, want once", n)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how log files are compressed. The zero value leaves them
+// uncompressed.
+type Compression string
+
+const (
+	CompressNone Compression = ""
+	// CompressGzip compresses log files with gzip once they are rotated out.
+	CompressGzip Compression = "gzip"
+	// CompressZstd writes log files through zstd as they are written.
+	CompressZstd Compression = "zstd"
+)
+
+// String implements flag.Value.
+func (c Compression) String() string {
+	if c == CompressNone {
+		return "none"
+	}
+	return string(c)
+}
+
+// Set implements flag.Value.
+func (c *Compression) Set(s string) error {
+	switch v := Compression(s); v {
+	case "none":
+		*c = CompressNone
+		return nil
+	case CompressGzip, CompressZstd:
+		*c = v
+		return nil
+	default:
+		return fmt.Errorf("unknown compression %q", s)
+	}
+}
+
+// gzipFile replaces the file with a gzipped copy named name+".gz". The copy
+// is written to a temporary file first, and the original is only removed
+// once the copy is complete, so nothing is lost if the process dies midway.
+// The copy is created with mode.
+func gzipFile(name string, mode os.FileMode) error {
+	gzName := name + ".gz"
+	// The file might have been compressed before the original could be
+	// removed.
+	if _, err := os.Stat(gzName); err == nil {
+		return os.Remove(name)
+	}
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := gzName + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, gzName); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// zstdComplete returns whether the file holds nothing but complete zstd
+// frames. Files that were being written to when the process died end in an
+// unterminated frame, which can still be decoded up to the last flush, but
+// can't be appended to.
+func zstdComplete(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	dec, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return false
+	}
+	defer dec.Close()
+	_, err = io.Copy(io.Discard, dec)
+	return err == nil
+}
+
+// fileExists returns whether the file exists, either as is or compressed.
+func fileExists(name string) bool {
+	for _, n := range []string{name, name + ".gz"} {
+		if _, err := os.Stat(n); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// workerEvents returns events of every kind that keeps state in the Logger,
+// for worker w to handle. The IDs don't overlap between workers, but the
+// guilds and users do.
+func workerEvents(w, n int) []interface{} {
+	var events []interface{}
+	for i := 0; i < n; i++ {
+		id := uint64(w*n + i + 1)
+		gid := discord.GuildID(i%3 + 1)
+		uid := discord.UserID(i%5 + 1)
+		user := discord.User{ID: uid, Username: fmt.Sprint("user", id)}
+		m := testMessage(gid, discord.MessageID(id))
+		m.Author = user
+		events = append(events,
+			m,
+			&gateway.MessageDeleteEvent{ID: discord.MessageID(id), ChannelID: testChannel, GuildID: gid},
+			&gateway.TypingStartEvent{ChannelID: testChannel, GuildID: gid, UserID: uid, Timestamp: discord.UnixTimestamp(time.Now().Unix())},
+			&gateway.VoiceStateUpdateEvent{VoiceState: discord.VoiceState{GuildID: gid, ChannelID: testChannel, UserID: uid}},
+			&gateway.VoiceStateUpdateEvent{VoiceState: discord.VoiceState{GuildID: gid, UserID: uid}},
+			&gateway.InviteCreateEvent{Code: fmt.Sprint("code", id), ChannelID: testChannel, GuildID: gid},
+			&gateway.InviteDeleteEvent{Code: fmt.Sprint("code", id), ChannelID: testChannel, GuildID: gid},
+			&StageInstanceCreateEvent{StageInstance{ID: discord.StageID(id), GuildID: gid, ChannelID: testChannel, Topic: "topic"}},
+			&StageInstanceDeleteEvent{StageInstance{ID: discord.StageID(id), GuildID: gid, ChannelID: testChannel}},
+			&gateway.GuildScheduledEventCreateEvent{GuildScheduledEvent: discord.GuildScheduledEvent{ID: discord.EventID(id), GuildID: gid, Name: "event"}},
+			&gateway.GuildMemberUpdateEvent{GuildID: gid, User: user},
+		)
+	}
+	return events
+}
+
+// TestConcurrentHandleEvent handles events from many goroutines at once, while
+// the log files are reopened. It's meant to be run with -race.
+func TestConcurrentHandleEvent(t *testing.T) {
+	const (
+		workers   = 8
+		perWorker = 50
+	)
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{})
+	l, _ := newTestLogger(t, Options{Typing: true})
+	l.store = fs
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(events []interface{}) {
+			defer wg.Done()
+			for _, ev := range events {
+				l.HandleEvent(ev)
+			}
+		}(workerEvents(w, perWorker))
+	}
+	stop := make(chan struct{})
+	reopened := make(chan struct{})
+	go func() {
+		defer close(reopened)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				l.Reopen()
+			}
+		}
+	}()
+	// Guilds go away while their events are handled.
+	l.HandleEvent(&gateway.GuildDeleteEvent{ID: 3})
+	wg.Wait()
+	close(stop)
+	<-reopened
+	l.Close()
+
+	var msgs int
+	for _, name := range logFiles(t, dir) {
+		s, err := scanLogFile(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkTrailer(t, name, s.Count)
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := FormatJSON.decoder(f)
+		var e Entry
+		for next(&e) == nil {
+			if e.Type == EntryMessage {
+				msgs++
+			}
+		}
+		f.Close()
+	}
+	if want := workers * perWorker; msgs != want {
+		t.Errorf("got %d msg entries, want %d", msgs, want)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// The config file is a TOML file whose keys are the names of the flags, e.g.
+//
+//	rotation = "daily"
+//	typing = true
+//	entries = ["msg", "editmsg", "delmsg"]
+//
+// along with a table of settings for each guild:
+//
+//	[guild.1234]
+//	channels = [5678]           # only log these channels
+//	exclude-channels = [9012]   # don't log these channels
+//	entries = ["ban", "unban"]  # overrides entries
+//	redact-content = true       # overrides redact-content
+//	retention-days = 30         # overrides retention-days
+//
+// Flags that are given on the command line take precedence over the
+// environment, which takes precedence over the config file. In the
+// environment, flags are given as $DISLOG_<FLAG>, in upper case and with
+// underscores instead of dashes, e.g. $DISLOG_ROTATION_TZ, and some flags can
+// be given by the names in envAliases as well.
+
+// configOnly are the flags that can't be set from the config file.
+var configOnly = map[string]bool{"config": true, "print-default-config": true}
+
+// envAliases are the environment variables that flags can be given in
+// besides $DISLOG_<FLAG>, which takes precedence over them.
+var envAliases = map[string]string{
+	"token":      "TOKEN",
+	"token-file": "TOKEN_FILE",
+	"dsn":        "DATABASE_URL",
+}
+
+// liveFlags are the flags that take effect when the config file is
+// reloaded. Changes to the others require a restart.
+var liveFlags = map[string]bool{
+	"guilds":            true,
+	"exclude-guilds":    true,
+	"entries":           true,
+	"log":               true,
+	"ignore-bots":       true,
+	"ignore-webhooks":   true,
+	"ignore-users":      true,
+	"retention-days":    true,
+	"retention-dry-run": true,
+	"redact-content":    true,
+}
+
+// config holds the settings in the config file that aren't flags.
+type config struct {
+	Guilds map[discord.GuildID]guildConfig
+
+	// name is the name of the config file. fixed are the flags that were
+	// given on the command line or in the environment, which the config
+	// file doesn't override, and applied are the values of the others that
+	// were taken from the config file.
+	name    string
+	fixed   map[string]bool
+	applied map[string]string
+}
+
+// guildConfig is a guild's table in the config file. The settings that are
+// nil aren't overridden for the guild.
+type guildConfig struct {
+	Channels  channelFilter
+	Entries   *EntryTypes
+	Redact    *bool
+	Retention *time.Duration
+}
+
+// loadConfig sets the flags that weren't given on the command line from the
+// environment or the config file, if name isn't empty. It returns the rest of
+// the config file.
+func loadConfig(name string) (cfg config, err error) {
+	cfg.name = name
+	cfg.fixed = make(map[string]bool)
+	cfg.applied = make(map[string]string)
+	flag.Visit(func(f *flag.Flag) { cfg.fixed[f.Name] = true })
+	values, err := readConfig(name, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+	var errs []error
+	flag.VisitAll(func(f *flag.Flag) {
+		if cfg.fixed[f.Name] || configOnly[f.Name] {
+			return
+		}
+		for _, env := range []string{envName(f.Name), envAliases[f.Name]} {
+			if v, ok := os.LookupEnv(env); ok && env != "" {
+				if err := f.Value.Set(v); err != nil {
+					errs = append(errs, fmt.Errorf("invalid $%s: %w", env, err))
+				}
+				cfg.fixed[f.Name] = true
+				return
+			}
+		}
+		v, ok := values[f.Name]
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in config file: %w", f.Name, err))
+		}
+		cfg.applied[f.Name] = v
+	})
+	return cfg, errors.Join(errs...)
+}
+
+// reloadConfig reads the config file again, and applies the changes to
+// liveFlags and the guilds' tables. The changes to other flags are only
+// reported. If the config file is invalid, nothing is changed and the old
+// config is returned.
+func reloadConfig(old config) (config, error) {
+	cfg := config{name: old.name, fixed: old.fixed, applied: make(map[string]string)}
+	values, err := readConfig(cfg.name, &cfg)
+	if err != nil {
+		return old, err
+	}
+	// prev holds the values of the flags that were changed, to restore
+	// them if any of the new values are invalid.
+	prev := make(map[string]string)
+	var restart []string
+	var errs []error
+	flag.VisitAll(func(f *flag.Flag) {
+		if cfg.fixed[f.Name] || configOnly[f.Name] {
+			return
+		}
+		v, ok := values[f.Name]
+		if ok {
+			cfg.applied[f.Name] = v
+		}
+		oldV, oldOK := old.applied[f.Name]
+		if v == oldV && ok == oldOK {
+			return
+		}
+		if !liveFlags[f.Name] {
+			restart = append(restart, f.Name)
+			cfg.applied[f.Name] = oldV
+			if !oldOK {
+				delete(cfg.applied, f.Name)
+			}
+			return
+		}
+		if !ok {
+			// The key was removed, so go back to the default.
+			v = f.DefValue
+		}
+		prev[f.Name] = f.Value.String()
+		if err := f.Value.Set(v); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in config file: %w", f.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		for name, v := range prev {
+			flag.Set(name, v)
+		}
+		return old, errors.Join(errs...)
+	}
+	if len(restart) > 0 {
+		log.Printf("Changes to %s in the config file only take effect after a restart.", strings.Join(restart, ", "))
+	}
+	return cfg, nil
+}
+
+// readConfig reads the config file, if name isn't empty, into cfg, and
+// returns the values of the flags in it, as they would be given on the
+// command line.
+func readConfig(name string, cfg *config) (map[string]string, error) {
+	values := make(map[string]string)
+	if name == "" {
+		return values, nil
+	}
+	var file map[string]interface{}
+	if _, err := toml.DecodeFile(name, &file); err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	for key, v := range file {
+		if key == "guild" {
+			guilds, err := parseGuildConfigs(v)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Guilds = guilds
+			continue
+		}
+		if f := flag.Lookup(key); f == nil || configOnly[key] {
+			return nil, fmt.Errorf("unknown key %q in config file", key)
+		}
+		s, err := configValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in config file: %w", key, err)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+// parseGuildConfigs parses the guild table of the config file.
+func parseGuildConfigs(v interface{}) (map[discord.GuildID]guildConfig, error) {
+	tables, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("guild in config file must be a table")
+	}
+	guilds := make(map[discord.GuildID]guildConfig)
+	for key, v := range tables {
+		id, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid guild ID %q in config file", key)
+		}
+		table, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("guild.%s in config file must be a table", key)
+		}
+		var g guildConfig
+		for name, v := range table {
+			var err error
+			switch name {
+			case "channels":
+				err = setConfigValue(&g.Channels.include, v)
+			case "exclude-channels":
+				err = setConfigValue(&g.Channels.exclude, v)
+			case "entries":
+				g.Entries = new(EntryTypes)
+				err = setConfigValue(g.Entries, v)
+			case "redact-content":
+				b, ok := v.(bool)
+				if !ok {
+					err = errors.New("must be true or false")
+				}
+				g.Redact = &b
+			case "retention-days":
+				days, ok := v.(int64)
+				if !ok || days < 0 {
+					err = errors.New("must be a number of days")
+				}
+				d := time.Duration(days) * 24 * time.Hour
+				g.Retention = &d
+			default:
+				return nil, fmt.Errorf("unknown key %q in guild.%s in config file", name, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s in guild.%s in config file: %w", name, key, err)
+			}
+		}
+		guilds[discord.GuildID(id)] = g
+	}
+	return guilds, nil
+}
+
+// overrides returns the filters of the guilds that have a table, with the
+// settings they don't override taken from global, for Filters.Overrides.
+func (c config) overrides(global Filters) map[discord.GuildID]GuildFilters {
+	overrides := make(map[discord.GuildID]GuildFilters)
+	for id, g := range c.Guilds {
+		f := GuildFilters{
+			Entries:  global.Entries,
+			Channels: g.Channels,
+			Redact:   global.Redact,
+		}
+		if g.Entries != nil {
+			f.Entries = *g.Entries
+		}
+		if g.Redact != nil {
+			f.Redact = *g.Redact
+		}
+		overrides[id] = f
+	}
+	return overrides
+}
+
+// retention returns the retention periods of the guilds that override it.
+func (c config) retention() map[discord.GuildID]time.Duration {
+	retention := make(map[discord.GuildID]time.Duration)
+	for id, g := range c.Guilds {
+		if g.Retention != nil {
+			retention[id] = *g.Retention
+		}
+	}
+	return retention
+}
+
+// setConfigValue sets the flag.Value to a value from the config file.
+func setConfigValue(f flag.Value, v interface{}) error {
+	s, err := configValue(v)
+	if err != nil {
+		return err
+	}
+	return f.Set(s)
+}
+
+// envName returns the environment variable that sets the flag.
+func envName(flagName string) string {
+	return "DISLOG_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// configValue returns a value from the config file as it would be given to
+// a flag. Arrays are joined with commas.
+func configValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case []interface{}:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			s, err := configValue(elem)
+			if err != nil {
+				return "", err
+			}
+			elems[i] = s
+		}
+		return strings.Join(elems, ","), nil
+	default:
+		return "", fmt.Errorf("unexpected value %v", v)
+	}
+}
+
+// WriteDefaultConfig writes a config file with every key commented out and
+// set to its default, along with the flag's usage.
+func WriteDefaultConfig(w io.Writer) error {
+	var b strings.Builder
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !configOnly[f.Name] {
+			flags = append(flags, f)
+		}
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	for _, f := range flags {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "# %s\n#%s = %s\n", f.Usage, f.Name, defaultValue(f))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// defaultValue returns the flag's default as a TOML value.
+func defaultValue(f *flag.Flag) string {
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return f.DefValue
+	}
+	if g, ok := f.Value.(flag.Getter); ok {
+		switch g.Get().(type) {
+		case int, int64, uint, uint64, float64:
+			return f.DefValue
+		}
+	}
+	return strconv.Quote(f.DefValue)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// currentDir is the directory within the log directory that holds a symlink
+// to the file that's currently being written to for every guild, e.g.
+// current/<guild>.ndjson, so that they can be followed across rotations.
+const currentDir = "current"
+
+// currentLink returns the name of the symlink to the key's current file. It
+// has the same extensions as the log files.
+func (fs *fileStore) currentLink(key fileKey) string {
+	link := "all"
+	switch {
+	case key.DM:
+		link = filepath.Join(dmDir, key.Channel.String())
+	case fs.opts.PathTemplate.has("{guild}"):
+		link = key.Guild.String()
+	}
+	if !key.DM && fs.opts.PathTemplate.has("{channel}") {
+		channel := "_guild"
+		if key.Channel.IsValid() {
+			channel = key.Channel.String()
+		}
+		link = filepath.Join(link, channel)
+	}
+	link += fs.opts.Format.ext()
+	if fs.opts.Compress == CompressZstd {
+		link += ".zst"
+	}
+	return filepath.Join(fs.path, currentDir, link)
+}
+
+// updateCurrent points the key's symlink in currentDir to the file. The link
+// is replaced atomically. If symlinks can't be created, it gives up on them.
+func (fs *fileStore) updateCurrent(key fileKey, name string) {
+	if fs.noSymlinks {
+		return
+	}
+	link := fs.currentLink(key)
+	target, err := filepath.Rel(filepath.Dir(link), name)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(link), fs.opts.DirMode)
+	}
+	if err == nil {
+		tmp := link + ".tmp"
+		os.Remove(tmp)
+		err = os.Symlink(target, tmp)
+		if err == nil {
+			err = os.Rename(tmp, link)
+		}
+	}
+	if err != nil {
+		log.Println("error updating current log file symlink, no longer updating them:", err)
+		fs.noSymlinks = true
+	}
+}
+
+// pruneCurrent removes the symlinks in currentDir whose file is gone, e.g.
+// because the guild isn't logged anymore.
+func (fs *fileStore) pruneCurrent() {
+	filepath.WalkDir(filepath.Join(fs.path, currentDir), func(name string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			os.Remove(name)
+		}
+		return nil
+	})
+}
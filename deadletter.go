@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// deadLetterName is the name of the dead letter file within the log
+// directory.
+const deadLetterName = "deadletter.ndjson"
+
+// deadLetter is a line of the dead letter file, which holds the entries that
+// couldn't be encoded or written, so that they can be recovered by hand. Data
+// is the entry's data if it could be encoded, and Value the data as printed
+// by %+v otherwise.
+type deadLetter struct {
+	Time  time.Time       `json:"time"`
+	Seq   uint64          `json:"seq,omitempty"`
+	Guild discord.GuildID `json:"guild,omitempty"`
+	Type  EntryType       `json:"type"`
+	Error string          `json:"error"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Value string          `json:"value,omitempty"`
+}
+
+// deadLetters appends to the dead letter file.
+type deadLetters struct {
+	mu   sync.Mutex
+	name string
+	mode os.FileMode
+}
+
+func newDeadLetters(dir string, dirMode, fileMode os.FileMode) (*deadLetters, error) {
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+	return &deadLetters{name: filepath.Join(dir, deadLetterName), mode: fileMode}, nil
+}
+
+// add appends the entry that failed with err to the dead letter file. If that
+// fails as well, the entry is only logged, so that failures never lead to
+// more dead letters.
+func (d *deadLetters) add(e Entry, guild discord.GuildID, data interface{}, cause error) {
+	dl := deadLetter{
+		Time:  e.Time,
+		Seq:   e.Seq,
+		Guild: guild,
+		Type:  e.Type,
+		Error: cause.Error(),
+		Data:  e.Data,
+	}
+	if dl.Data == nil {
+		dl.Value = fmt.Sprintf("%+v", data)
+	}
+	if err := d.write(dl); err != nil {
+		log.Printf("error writing dead letter, lost %s entry: %v: %+v", e.Type, err, data)
+	}
+}
+
+func (d *deadLetters) write(dl deadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, d.mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// replaySize is how many of the message events last handled in a guild are
+// remembered to detect replays. Events are only replayed from around the time
+// the gateway disconnected, so this only needs to cover a short window.
+const replaySize = 512
+
+// replayKey identifies a message event. Edits are told apart by their edit
+// timestamp, so that a message being edited again isn't taken for a replay.
+type replayKey struct {
+	typ    EntryType
+	id     discord.MessageID
+	edited discord.Timestamp
+}
+
+// replays remembers the last replaySize message events of each guild, with
+// direct messages as guild 0. When the gateway resumes a session, Discord may
+// send events again that were already handled, which would otherwise be
+// logged twice. It's safe for concurrent use.
+type replays struct {
+	mu     sync.Mutex
+	guilds map[discord.GuildID]*replayRing
+}
+
+// replayRing holds a guild's keys, the oldest of which is overwritten once
+// it's full.
+type replayRing struct {
+	keys [replaySize]replayKey
+	next int
+	seen map[replayKey]bool
+}
+
+// replayKeyOf returns the key of the event, or false if it's not checked for
+// replays. Partial updates have no edit timestamp to tell them apart, so
+// they're always logged.
+func replayKeyOf(ev interface{}) (discord.GuildID, replayKey, bool) {
+	switch ev := ev.(type) {
+	case *gateway.MessageCreateEvent:
+		return ev.GuildID, replayKey{typ: EntryMessage, id: ev.ID}, true
+	case *gateway.MessageUpdateEvent:
+		if !ev.EditedTimestamp.IsValid() {
+			break
+		}
+		return ev.GuildID, replayKey{EntryMessageEdit, ev.ID, ev.EditedTimestamp}, true
+	case *gateway.MessageDeleteEvent:
+		return ev.GuildID, replayKey{typ: EntryMessageDelete, id: ev.ID}, true
+	}
+	return 0, replayKey{}, false
+}
+
+// replayed returns whether the event was already handled, and remembers it if
+// it wasn't.
+func (r *replays) replayed(ev interface{}) bool {
+	gid, key, ok := replayKeyOf(ev)
+	if !ok {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ring := r.guilds[gid]
+	if ring == nil {
+		if r.guilds == nil {
+			r.guilds = make(map[discord.GuildID]*replayRing)
+		}
+		ring = &replayRing{seen: make(map[replayKey]bool)}
+		r.guilds[gid] = ring
+	}
+	if ring.seen[key] {
+		return true
+	}
+	delete(ring.seen, ring.keys[ring.next])
+	ring.keys[ring.next] = key
+	ring.next = (ring.next + 1) % replaySize
+	ring.seen[key] = true
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func TestReplayedMessage(t *testing.T) {
+	l, st := newTestLogger(t, Options{})
+	ev := testMessage(1, 10)
+	l.HandleEvent(ev)
+	l.HandleEvent(ev)
+	// The same message in another guild isn't a replay.
+	l.HandleEvent(testMessage(2, 10))
+	l.Close()
+	if n := len(st.entries(EntryMessage)); n != 2 {
+		t.Errorf("got %d msg entries, want 2", n)
+	}
+}
+
+func TestReplayedEdits(t *testing.T) {
+	l, st := newTestLogger(t, Options{})
+	edit := func(at time.Time) *gateway.MessageUpdateEvent {
+		return &gateway.MessageUpdateEvent{Message: discord.Message{
+			ID:              10,
+			GuildID:         1,
+			ChannelID:       testChannel,
+			Author:          discord.User{ID: 1, Username: "user"},
+			Content:         "edited",
+			EditedTimestamp: discord.NewTimestamp(at),
+		}}
+	}
+	first := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	l.HandleEvent(edit(first))
+	l.HandleEvent(edit(first))
+	// Editing the message again is logged.
+	l.HandleEvent(edit(first.Add(time.Minute)))
+	// Updates that aren't edits can't be told apart, so they're all
+	// logged.
+	partial := &gateway.MessageUpdateEvent{Message: discord.Message{ID: 10, GuildID: 1, ChannelID: testChannel}}
+	l.HandleEvent(partial)
+	l.HandleEvent(partial)
+	l.Close()
+	if n := len(st.entries(EntryMessageEdit)); n != 4 {
+		t.Errorf("got %d editmsg entries, want 4", n)
+	}
+}
+
+func TestReplaysForget(t *testing.T) {
+	var r replays
+	first := testMessage(1, 1)
+	r.replayed(first)
+	for id := discord.MessageID(2); id <= replaySize+1; id++ {
+		if r.replayed(testMessage(1, id)) {
+			t.Fatalf("message %d was taken for a replay", id)
+		}
+	}
+	if r.replayed(first) {
+		t.Errorf("the first message is still remembered after %d others", replaySize)
+	}
+}
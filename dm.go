@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/bot/extras/infer"
+)
+
+// dmDir is the directory that the log files of direct messages are kept in,
+// where the guilds' files would be.
+const dmDir = "dm"
+
+// isDM returns whether the event is about a direct message, including those
+// in group DMs. Only messages being sent, edited and deleted are logged for
+// them.
+func isDM(ev interface{}) bool {
+	switch ev.(type) {
+	case *gateway.MessageCreateEvent, *gateway.MessageUpdateEvent, *gateway.MessageDeleteEvent:
+		return !infer.GuildID(ev).IsValid()
+	}
+	return false
+}
+
+// LogsEvent returns whether the event is logged, going by its guild, or by
+// Options.DMs if it has none.
+func (l *Logger) LogsEvent(ev interface{}) bool {
+	if id := infer.GuildID(ev); id.IsValid() {
+		return l.LogsGuild(id)
+	}
+	return l.opts.DMs && isDM(ev)
+}
+
+// dms returns the template of the log files of direct messages, which have a
+// file per channel in dmDir. {guild} is replaced by dmDir, followed by
+// {channel} unless the template has it already. Templates without {guild} get
+// dmDir next to their files, e.g. {year}-{week}/all.ndjson becomes
+// {year}-{week}/dm/{channel}.ndjson.
+func (p PathTemplate) dms() PathTemplate {
+	s := string(p)
+	switch {
+	case p.has("{guild}") && p.has("{channel}"):
+		return PathTemplate(strings.ReplaceAll(s, "{guild}", dmDir))
+	case p.has("{guild}"):
+		return PathTemplate(strings.ReplaceAll(s, "{guild}", dmDir+"/{channel}"))
+	}
+	dir, base := path.Split(s)
+	for _, f := range templateFields {
+		if strings.Contains(base, f) {
+			// Keep the time placeholders in the file name.
+			return PathTemplate(dir + dmDir + "/{channel}/" + base)
+		}
+	}
+	return PathTemplate(dir + dmDir + "/{channel}.ndjson")
+}
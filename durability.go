@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Durability is when log files are synced to disk. Positive values sync all
+// open log files at that interval. The zero value only syncs them when they
+// are rotated out or closed, which can lose whatever the OS hadn't written
+// yet on a power loss.
+type Durability time.Duration
+
+const (
+	// SyncOnRotate only syncs log files when they are rotated out or closed.
+	SyncOnRotate Durability = 0
+	// SyncEveryEntry syncs the log file after every entry.
+	SyncEveryEntry Durability = -1
+)
+
+// String implements flag.Value.
+func (d Durability) String() string {
+	switch {
+	case d == SyncOnRotate:
+		return "rotate"
+	case d < 0:
+		return "entry"
+	default:
+		return time.Duration(d).String()
+	}
+}
+
+// Set implements flag.Value.
+func (d *Durability) Set(s string) error {
+	switch s {
+	case "rotate":
+		*d = SyncOnRotate
+		return nil
+	case "entry":
+		*d = SyncEveryEntry
+		return nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("unknown sync policy %q", s)
+	}
+	*d = Durability(interval)
+	return nil
+}
+
+// syncLoop syncs the open log files at the interval, until fs.done is closed.
+// Files that fail to be synced are abandoned like ones that fail to be
+// flushed, since what was written to them may not be on disk.
+func (fs *fileStore) syncLoop(interval time.Duration) {
+	defer fs.loops.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fs.mu.Lock()
+			for key, file := range fs.files {
+				if err := file.Sync(); err != nil {
+					log.Println("error syncing log file:", err)
+					fs.abandon(key, file)
+				}
+			}
+			fs.mu.Unlock()
+		case <-fs.done:
+			return
+		}
+	}
+}
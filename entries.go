@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// entryCategories maps the types of entries that are logged to the
+// categories that -log turns on and off. Every new type of entry needs to be
+// added here, which also makes it known to -entries. Only EntryEOF and
+// EntryDropped are left out, as they are always written.
+var entryCategories = map[EntryType]string{
+	EntryMessage:             "messages",
+	EntryMessageEdit:         "messages",
+	EntryMessageDelete:       "messages",
+	EntryMessageDeleteBulk:   "messages",
+	EntryPins:                "messages",
+	EntryPublished:           "messages",
+	EntryReactionAdd:         "reactions",
+	EntryReactionRemove:      "reactions",
+	EntryReactionRemoveAll:   "reactions",
+	EntryReactionRemoveEmoji: "reactions",
+	EntryMemberJoin:          "members",
+	EntryMemberLeave:         "members",
+	EntryMemberUpdate:        "members",
+	EntryRename:              "members",
+	EntryBoost:               "members",
+	EntryBan:                 "moderation",
+	EntryUnban:               "moderation",
+	EntryVoice:               "voice",
+	EntryVoiceSession:        "voice",
+	EntryStage:               "voice",
+	EntryChannel:             "channels",
+	EntryChannelMove:         "channels",
+	EntrySlowmode:            "channels",
+	EntryThread:              "channels",
+	EntryWebhooks:            "channels",
+	EntryInvite:              "channels",
+	EntryRole:                "roles",
+	EntryGuildUpdate:         "guild",
+	EntryEmojis:              "guild",
+	EntryIntegrations:        "guild",
+	EntryGuildBoost:          "guild",
+	EntryScheduledEvent:      "events",
+	EntryRSVP:                "events",
+	EntryCommand:             "interactions",
+	EntryComponent:           "interactions",
+	EntryTyping:              "typing",
+	EntryPresence:            "presence",
+}
+
+// EntryTypes is a set of entry types, given as a comma-separated list. A nil
+// EntryTypes, or an empty list, stands for all of them.
+type EntryTypes map[EntryType]bool
+
+// String implements flag.Value.
+func (t EntryTypes) String() string {
+	var types []string
+	for typ := range t {
+		types = append(types, string(typ))
+	}
+	sort.Strings(types)
+	return strings.Join(types, ",")
+}
+
+// Set implements flag.Value.
+func (t *EntryTypes) Set(s string) error {
+	if s == "" {
+		*t = nil
+		return nil
+	}
+	set := make(EntryTypes)
+	for _, typ := range strings.Split(s, ",") {
+		typ := EntryType(strings.TrimSpace(typ))
+		if _, ok := entryCategories[typ]; !ok {
+			return fmt.Errorf("unknown entry type %q", typ)
+		}
+		set[typ] = true
+	}
+	*t = set
+	return nil
+}
+
+// has returns whether the type is in the set.
+func (t EntryTypes) has(typ EntryType) bool {
+	return t == nil || t[typ]
+}
+
+// Categories is a set of categories of entries, as in entryCategories,
+// given as a comma-separated list. A nil Categories stands for all of them.
+type Categories map[string]bool
+
+// String implements flag.Value.
+func (c Categories) String() string {
+	var names []string
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// Set implements flag.Value.
+func (c *Categories) Set(s string) error {
+	if s == "" {
+		*c = nil
+		return nil
+	}
+	known := make(map[string]bool)
+	for _, name := range entryCategories {
+		known[name] = true
+	}
+	set := make(Categories)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !known[name] {
+			return fmt.Errorf("unknown category %q", name)
+		}
+		set[name] = true
+	}
+	*c = set
+	return nil
+}
+
+// has returns whether the type of entry is in one of the categories.
+func (c Categories) has(typ EntryType) bool {
+	return c == nil || c[entryCategories[typ]]
+}
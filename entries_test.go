@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// filled returns a copy of the entry with every field set to something that
+// isn't left out as empty.
+func filled(entry interface{}) interface{} {
+	v := reflect.New(reflect.TypeOf(entry)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f.SetInt(1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f.SetUint(1)
+		case reflect.Float32, reflect.Float64:
+			f.SetFloat(1)
+		case reflect.String:
+			f.SetString("x")
+		case reflect.Pointer:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Map:
+			m := reflect.MakeMap(f.Type())
+			m.SetMapIndex(reflect.New(f.Type().Key()).Elem(), reflect.New(f.Type().Elem()).Elem())
+			f.Set(m)
+		case reflect.Interface:
+			f.Set(reflect.ValueOf("x"))
+		case reflect.Struct:
+			// The fields of embedded structs are written inline.
+			if v.Type().Field(i).Anonymous {
+				f.Set(reflect.ValueOf(filled(f.Interface())))
+			}
+		}
+	}
+	return v.Interface()
+}
+
+// keys returns the keys of the JSON object, in order.
+func keys(t *testing.T, b []byte) string {
+	t.Helper()
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+// TestEntryShapes pins the keys that every entry's data is written with. If
+// one of them has to change, so does EntryVersion.
+func TestEntryShapes(t *testing.T) {
+	tests := []struct {
+		entry interface{}
+		keys  string
+	}{
+		{BanEntry{}, "user"},
+		{BoostEntry{}, "boosting user"},
+		{ChannelEntry{}, "action id name oldName oldTopic overwrites topic type"},
+		{ChannelMoveEntry{}, "channel from to"},
+		{CommandEntry{}, "channel name options target user"},
+		{ComponentEntry{}, "channel customID message type user values"},
+		{DroppedEntry{}, "events"},
+		{EOFEntry{}, "entries sha256"},
+		{EmojisEntry{}, "added emojis removed renamed snapshot"},
+		{GuildBoostEntry{}, "boosts oldBoosts oldTier tier"},
+		{GuildUpdateEntry{}, "after before"},
+		{IntegrationsEntry{}, "integrations"},
+		{InviteEntry{}, "action channel code expires inviter maxUses temporary"},
+		{MemberEntry{}, "bot created joined user"},
+		{MemberLeaveEntry{}, "user"},
+		{MemberUpdateEntry{}, "addedRoles nick oldNick removedRoles roles user"},
+		{MessageDeleteBulkEntry{}, "channel count ids messages"},
+		{MessageDeleteEntry{}, "cached channel id message"},
+		{MessageEditEntry{}, "author channel components content editedTimestamp embeds id oldContent partial redacted"},
+		{MessageEntry{}, "attachments author channel components content editedTimestamp embeds flags id member mentions pinned redacted replyTo stickers system time tts type webhookID"},
+		{PinsEntry{}, "channel lastPin pinned"},
+		{PresenceEntry{}, "activity status user"},
+		{PublishedEntry{}, "channel id"},
+		{RSVPEntry{}, "event interested name user"},
+		{ReactionClearEntry{}, "channel emoji message"},
+		{ReactionEntry{}, "channel emoji message user"},
+		{RenameEntry{}, "oldTag tag user"},
+		{RoleEntry{}, "action color id name old permissions position"},
+		{ScheduledEventEntry{}, "action channel creator description end id interested location name oldStatus start status"},
+		{SlowmodeEntry{}, "channel new old"},
+		{StageEntry{}, "action channel id oldTopic privacy topic"},
+		{ThreadEntry{}, "action archived autoArchive creator id locked name parent starterMessage tags type"},
+		{TypingEntry{}, "channel time user"},
+		{VoiceEntry{}, "channel deaf from mute selfDeaf selfMute user"},
+		{VoiceSessionEntry{}, "channel duration incomplete joined left user"},
+		{WebhooksEntry{}, "channel webhooks"},
+	}
+	for _, test := range tests {
+		b, err := json.Marshal(filled(test.entry))
+		if err != nil {
+			t.Fatalf("%T: %v", test.entry, err)
+		}
+		if got := keys(t, b); got != test.keys {
+			t.Errorf("%T is written with the keys\n\t%s\nwant\n\t%s", test.entry, got, test.keys)
+		}
+	}
+}
+
+func TestChannelEntryID(t *testing.T) {
+	l, st := newTestLogger(t, Options{})
+	l.HandleEvent(&gateway.ChannelCreateEvent{Channel: discord.Channel{ID: 200, GuildID: 1, Name: "new", Type: discord.GuildText}})
+	l.Close()
+	entries := st.entries(EntryChannel)
+	if len(entries) != 1 {
+		t.Fatalf("got %d channel entries, want 1", len(entries))
+	}
+	var c ChannelEntry
+	if err := json.Unmarshal(entries[0].Data, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != 200 {
+		t.Errorf("channel entry %s has ID %v, want 200", entries[0].Data, c.ID)
+	}
+}
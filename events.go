@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/bot/extras/infer"
+)
+
+const (
+	// defaultEventQueueSize is how many events are queued for the Logger
+	// if -event-queue isn't given.
+	defaultEventQueueSize = 4096
+	// droppedReportInterval is how often the events that were dropped are
+	// reported.
+	droppedReportInterval = time.Minute
+)
+
+// EntryDropped is written when events of the guild were dropped because the
+// event queue was full.
+const EntryDropped EntryType = "dropped"
+
+// DroppedEntry counts the events that were dropped since the last one, which
+// are missing from the log.
+type DroppedEntry struct {
+	Events int `json:"events"`
+}
+
+// eventQueue is a bounded queue of the events between the gateway and the
+// Logger. Events that don't fit are dropped and counted, instead of waiting
+// out of sight in the gateway's handler goroutines.
+type eventQueue struct {
+	events chan interface{}
+	// onDrop is called with every event that's dropped, if it's set.
+	onDrop func(interface{})
+
+	mu      sync.Mutex
+	dropped map[discord.GuildID]int
+}
+
+func newEventQueue(size int, onDrop func(interface{})) *eventQueue {
+	return &eventQueue{
+		events:  make(chan interface{}, size),
+		onDrop:  onDrop,
+		dropped: make(map[discord.GuildID]int),
+	}
+}
+
+// push queues the event, or drops it if the queue is full. It never blocks, so
+// that it can be called from the gateway's event loop.
+func (q *eventQueue) push(ev interface{}) {
+	select {
+	case q.events <- ev:
+	default:
+		q.drop(ev)
+	}
+}
+
+func (q *eventQueue) drop(ev interface{}) {
+	if q.onDrop != nil {
+		q.onDrop(ev)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropped[infer.GuildID(ev)]++
+}
+
+// drain hands the events that are still queued to handle. The events that
+// are left once the timeout passed are dropped. Nothing may be pushed anymore
+// once it's called.
+func (q *eventQueue) drain(handle func(interface{}), timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case ev := <-q.events:
+			if time.Now().After(deadline) {
+				q.drop(ev)
+				continue
+			}
+			handle(ev)
+		default:
+			return
+		}
+	}
+}
+
+// takeDropped returns how many events of every guild were dropped since it
+// was last called.
+func (q *eventQueue) takeDropped() map[discord.GuildID]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped := q.dropped
+	q.dropped = make(map[discord.GuildID]int)
+	return dropped
+}
+
+// LogDropped reports the events that were dropped, as returned by
+// eventQueue.takeDropped. A DroppedEntry is written for every guild, whatever
+// the filters are.
+func (l *Logger) LogDropped(dropped map[discord.GuildID]int) {
+	var total int
+	for gid, n := range dropped {
+		total += n
+		if err := l.writeEntry(gid, EntryDropped, DroppedEntry{Events: n}); err != nil {
+			log.Println("error while logging dropped events:", err)
+		}
+	}
+	if total > 0 {
+		log.Printf("dropped %d events in %d guilds because the event queue was full", total, len(dropped))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// snapshotted returns a message update event that the Logger has a snapshot
+// for.
+func snapshotted(l *Logger, id discord.MessageID) *gateway.MessageUpdateEvent {
+	ev := &gateway.MessageUpdateEvent{Message: discord.Message{ID: id, GuildID: 1, ChannelID: testChannel}}
+	l.s.Cabinet.MessageSet(&discord.Message{ID: id, GuildID: 1, ChannelID: testChannel, Content: "old"}, false)
+	l.Snapshot(ev)
+	return ev
+}
+
+func TestDroppedEventsForgetSnapshot(t *testing.T) {
+	l, _ := newTestLogger(t, Options{})
+	defer l.Close()
+	q := newEventQueue(1, l.Forget)
+	q.push(snapshotted(l, 10))
+	// The queue is full, so this one is dropped.
+	q.push(snapshotted(l, 11))
+	if n := len(l.prev); n != 1 {
+		t.Errorf("%d snapshots are kept after an event was dropped from a full queue, want 1", n)
+	}
+	// It's too late to handle what's left.
+	q.drain(l.HandleEvent, -1)
+	if n := len(l.prev); n != 0 {
+		t.Errorf("%d snapshots are kept after the queue was drained too late, want 0", n)
+	}
+	if dropped := q.takeDropped(); dropped[1] != 2 {
+		t.Errorf("%d events were counted as dropped, want 2", dropped[1])
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	const n = 10
+	q := newEventQueue(n, nil)
+	for i := 0; i < n; i++ {
+		q.push(testMessage(1, discord.MessageID(i+1)))
+	}
+	const (
+		timeout = 50 * time.Millisecond
+		each    = 20 * time.Millisecond
+	)
+	var handled int
+	start := time.Now()
+	q.drain(func(interface{}) {
+		handled++
+		time.Sleep(each)
+	}, timeout)
+	// The event that's being handled when the timeout passes is finished.
+	if took := time.Since(start); took > timeout+2*each {
+		t.Errorf("draining took %v with a timeout of %v", took, timeout)
+	}
+	dropped := q.takeDropped()[1]
+	if handled == 0 || handled == n {
+		t.Errorf("%d of %d events were handled before the timeout, want some of them", handled, n)
+	}
+	if handled+dropped != n {
+		t.Errorf("%d events were handled and %d dropped, want %d in all", handled, dropped, n)
+	}
+}
+
+func TestDrainAll(t *testing.T) {
+	const n = 10
+	q := newEventQueue(n, nil)
+	for i := 0; i < n; i++ {
+		q.push(testMessage(1, discord.MessageID(i+1)))
+	}
+	var handled int
+	q.drain(func(interface{}) { handled++ }, time.Minute)
+	if handled != n {
+		t.Errorf("%d of %d events were handled, want all of them", handled, n)
+	}
+	if dropped := q.takeDropped(); len(dropped) != 0 {
+		t.Errorf("events were dropped: %v", dropped)
+	}
+}
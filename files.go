@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// fileStore writes entries to log files in a directory, as laid out by
+// the path template.
+type fileStore struct {
+	path string
+	opts Options
+
+	mu sync.Mutex
+	// files holds the open log files, which stay open until they are
+	// rotated out, reopened or the store is closed, or until they are
+	// evicted to keep no more than Options.MaxOpenFiles open. uses counts
+	// the entries written, to tell which file was written to last.
+	files   map[fileKey]*logFile
+	evicted map[fileKey]evictedFile
+	uses    uint64
+	// noSymlinks is set once creating a symlink in currentDir failed.
+	noSymlinks bool
+	// buf is reused to encode entries in.
+	buf bytes.Buffer
+
+	// finishing tracks the log files being compressed or uploaded.
+	finishing sync.WaitGroup
+	// done is closed when the store is closed, and loops tracks the
+	// goroutines that stop when it is.
+	done  chan struct{}
+	loops sync.WaitGroup
+}
+
+func newFileStore(path string, opts Options) *fileStore {
+	if opts.PathTemplate == "" {
+		opts.PathTemplate = defaultTemplate(opts.Rotation, opts.Layout)
+	}
+	if opts.RotationZone == nil {
+		opts.RotationZone = time.UTC
+	}
+	if opts.MaxOpenFiles <= 0 {
+		opts.MaxOpenFiles = defaultMaxOpenFiles
+	}
+	fs := &fileStore{
+		path:    path,
+		opts:    opts,
+		files:   make(map[fileKey]*logFile),
+		evicted: make(map[fileKey]evictedFile),
+		done:    make(chan struct{}),
+	}
+	fs.loops.Add(1)
+	go fs.flushLoop()
+	fs.pruneCurrent()
+	if opts.Archive != nil {
+		fs.resumeUploads()
+	}
+	// The loop runs even without a retention period, since one can be set
+	// later with SetRetention.
+	fs.loops.Add(1)
+	go fs.pruneLoop()
+	if opts.Durability > 0 {
+		fs.loops.Add(1)
+		go fs.syncLoop(time.Duration(opts.Durability))
+	}
+	return fs
+}
+
+func (fs *fileStore) Close() error {
+	close(fs.done)
+	fs.loops.Wait()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	names, err := fs.closeAll()
+	if fs.opts.Archive != nil {
+		fs.uploadOpen(names)
+	}
+	fs.finishing.Wait()
+	return err
+}
+
+// Reopen closes the open log files, so that they are opened again by the next
+// entry written to them. This lets logrotate move them out of the way. It
+// returns how many files were closed, and the errors of the ones that failed
+// to be.
+func (fs *fileStore) Reopen() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	names, err := fs.closeAll()
+	return len(names), err
+}
+
+// closeAll closes the log files with their EOFEntry, including the ones that
+// makeRoom closed, which are opened again for it. It returns the names of the
+// files, and the errors of the ones that failed to be closed, which are marked
+// as truncated. It must be called with fs.mu held.
+func (fs *fileStore) closeAll() ([]string, error) {
+	var names []string
+	var errs []error
+	closeFile := func(key fileKey, f *logFile) {
+		if err := fs.closeLogFile(f); err != nil {
+			errs = append(errs, fmt.Errorf("error closing %s: %w", f.Name(), err))
+			fs.markTruncated(f.Name())
+		}
+		delete(fs.files, key)
+		names = append(names, f.Name())
+	}
+	for key, f := range fs.files {
+		closeFile(key, f)
+	}
+	for key := range fs.evicted {
+		if f, ok := fs.reopenEvicted(key); ok {
+			closeFile(key, f)
+		}
+	}
+	return names, errors.Join(errs...)
+}
+
+// closeLogFile ends the log file with its EOFEntry, and syncs and closes it.
+func (fs *fileStore) closeLogFile(f *logFile) error {
+	err := fs.writeTrailer(f)
+	if err != nil {
+		err = fmt.Errorf("error writing eof entry: %w", err)
+	}
+	return errors.Join(err, f.Sync(), f.Close())
+}
+
+// flushInterval is how often the log files' buffers, and the zstd frames of
+// compressed ones, are flushed. Entries that weren't flushed yet are lost if
+// the process dies.
+const flushInterval = time.Second
+
+// logBufferSize is the size of the buffer that entries are collected in
+// before they are written to a log file.
+const logBufferSize = 32 << 10
+
+type logFile struct {
+	*os.File
+	Period string
+	// Part is the number of the file within the period, which is only
+	// above 0 if the period's earlier files grew too large.
+	Part int
+	// Size is how many bytes the file holds. For zstd-compressed files, it
+	// is the size on disk when the file was opened plus the uncompressed
+	// size of what was written since, so it's an overestimate.
+	Size int64
+	// Last is when the last entry was written to the file.
+	Last time.Time
+	// Count is the number of entries in the file, and hash the hash of
+	// their encoding, for the file's EOFEntry.
+	Count int
+	hash  hash.Hash
+	// used is the value of fileStore.uses when the file was last written
+	// to.
+	used uint64
+
+	// bw buffers what's written to the file, or to zw for zstd-compressed
+	// files.
+	bw *bufio.Writer
+	zw *zstd.Encoder
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	return f.bw.Write(p)
+}
+
+// Flush writes out what's buffered, including what the compressor has
+// buffered if the file is compressed.
+func (f *logFile) Flush() error {
+	if err := f.bw.Flush(); err != nil {
+		return err
+	}
+	if f.zw != nil {
+		return f.zw.Flush()
+	}
+	return nil
+}
+
+func (f *logFile) Sync() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+// Close flushes the file's buffer and ends its zstd frame, if it has one,
+// before closing it.
+func (f *logFile) Close() error {
+	if err := f.bw.Flush(); err != nil {
+		f.File.Close()
+		return err
+	}
+	if f.zw != nil {
+		if err := f.zw.Close(); err != nil {
+			f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
+
+// Append writes the entry to the file it belongs in, opening a new one if the
+// period changed or the current one is full.
+func (fs *fileStore) Append(r Record) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	now := r.Entry.Time.In(fs.opts.RotationZone)
+	period := fs.opts.PathTemplate.period(now)
+	var key fileKey
+	switch {
+	case !r.Guild.IsValid():
+		// Direct messages have a file per channel.
+		key.DM, key.Channel = true, r.Channel
+	case fs.opts.PathTemplate.has("{guild}"):
+		key.Guild = r.Guild
+	default:
+		// Entries from all guilds end up in the same file.
+		r.Entry.Guild = r.Guild
+	}
+	if r.Guild.IsValid() && fs.opts.PathTemplate.has("{channel}") {
+		key.Channel = r.Channel
+	}
+	logfile, ok := fs.files[key]
+	if !ok {
+		logfile, ok = fs.reopenEvicted(key)
+	}
+	if logfile != nil {
+		// If the clock went backwards, stay in the current file rather
+		// than going back to the previous period's.
+		if logfile.Period != period && !now.Before(logfile.Last) {
+			ok = false
+		}
+	}
+	// Encode the entry up front, so that it's known whether it still fits
+	// in the current file.
+	buf := &fs.buf
+	buf.Reset()
+	if err := fs.opts.Format.encode(buf, r.Entry); err != nil {
+		return fmt.Errorf("error encoding entry: %w", err)
+	}
+	if ok && fs.opts.MaxSize > 0 && logfile.Size > 0 &&
+		logfile.Size+int64(buf.Len()) > fs.opts.MaxSize {
+		ok = false
+	}
+	if !ok {
+		var err error
+		part := -1
+		if logfile != nil {
+			if err := fs.closeLogFile(logfile); err != nil {
+				log.Printf("error closing %s: %v", logfile.Name(), err)
+			}
+			delete(fs.files, key)
+			fs.finish(logfile.Name())
+			if logfile.Period == period {
+				part = logfile.Part + 1
+			}
+		}
+		// The entry doesn't go in the file that's closed to make room,
+		// so its errors are only logged.
+		if err := fs.makeRoom(); err != nil {
+			log.Println(err)
+		}
+		logfile, err = fs.openLogFile(key, now, part)
+		if err != nil {
+			return err
+		}
+		fs.files[key] = logfile
+		fs.updateCurrent(key, logfile.Name())
+	}
+	n, err := logfile.Write(buf.Bytes())
+	if err != nil {
+		fs.abandon(key, logfile)
+		return fmt.Errorf("error writing to log file: %w", err)
+	}
+	logfile.Size += int64(n)
+	logfile.Count++
+	logfile.hash.Write(buf.Bytes())
+	logfile.Last = now
+	fs.uses++
+	logfile.used = fs.uses
+	if fs.opts.Durability == SyncEveryEntry {
+		if err := logfile.Sync(); err != nil {
+			fs.abandon(key, logfile)
+			return fmt.Errorf("error syncing log file: %w", err)
+		}
+	}
+	return nil
+}
+
+// openLogFile opens the given part of the log file for the period that t falls
+// in. If part is negative, the last existing part is opened, or the next one if
+// it has no room left.
+func (fs *fileStore) openLogFile(key fileKey, t time.Time, part int) (*logFile, error) {
+	if part < 0 {
+		part = 0
+		for fileExists(fs.logfileName(key, t, part+1)) {
+			part++
+		}
+	}
+	name := fs.logfileName(key, t, part)
+	// Parts that were compressed are done, and so are the ones that may be
+	// truncated.
+	if _, err := os.Stat(name + ".gz"); err == nil {
+		return fs.openLogFile(key, t, part+1)
+	}
+	if _, err := os.Stat(truncatedMarker(name)); err == nil {
+		return fs.openLogFile(key, t, part+1)
+	}
+	err := os.MkdirAll(filepath.Dir(name), fs.opts.DirMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, fs.opts.FileMode)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	// Count what's already there when reopening a file after a restart.
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	logfile := &logFile{
+		File:   file,
+		Period: fs.opts.PathTemplate.period(t),
+		Part:   part,
+		Size:   info.Size(),
+	}
+	if fs.opts.MaxSize > 0 && logfile.Size >= fs.opts.MaxSize {
+		file.Close()
+		return fs.openLogFile(key, t, part+1)
+	}
+	if fs.opts.Compress == CompressZstd && logfile.Size > 0 && !zstdComplete(name) {
+		log.Printf("%s wasn't closed properly, continuing in a new file", name)
+		file.Close()
+		return fs.openLogFile(key, t, part+1)
+	}
+	logfile.hash = sha256.New()
+	if logfile.Size > 0 {
+		// Carry on counting and hashing where the file was left off.
+		s, err := scanLogFile(name)
+		if err != nil {
+			log.Printf("%s can't be read (%v), continuing in a new file", name, err)
+			file.Close()
+			return fs.openLogFile(key, t, part+1)
+		}
+		if s.Trailer != nil {
+			// The file was closed when dislog stopped or reopened its
+			// files. Files that were rotated out are never the last
+			// part. The EOFEntry can be taken off uncompressed files,
+			// but compressed ones are continued in a new file.
+			if fs.opts.Compress == CompressZstd {
+				file.Close()
+				return fs.openLogFile(key, t, part+1)
+			}
+			if err := file.Truncate(s.Size); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("error opening log file: %w", err)
+			}
+			logfile.Size = s.Size
+		}
+		logfile.Count, logfile.hash = s.Count, s.Hash
+	}
+	if err := fs.startWriting(logfile); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return logfile, nil
+}
+
+// startWriting sets up the buffer, and the compressor if there is one, that
+// entries are written to the opened log file through.
+func (fs *fileStore) startWriting(f *logFile) error {
+	f.bw = bufio.NewWriterSize(f.File, logBufferSize)
+	if fs.opts.Compress == CompressZstd {
+		var err error
+		f.zw, err = zstd.NewWriter(f.File, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("error opening log file: %w", err)
+		}
+		f.bw.Reset(f.zw)
+	}
+	return nil
+}
+
+// defaultMaxOpenFiles is how many log files are kept open if
+// Options.MaxOpenFiles isn't set.
+const defaultMaxOpenFiles = 256
+
+// evictedFile is a log file that was closed to make room for another one. It's
+// remembered so that it can be continued, or rotated out, by the next entry
+// that would have gone in it. Its size on disk, count and hash are kept so
+// that it needn't be read again when it's continued.
+type evictedFile struct {
+	Name  string
+	Last  time.Time
+	Part  int
+	Size  int64
+	Count int
+	hash  hash.Hash
+}
+
+// makeRoom closes the log file that was written to the longest ago, if as
+// many as Options.MaxOpenFiles are open. If it fails to be synced or closed,
+// it's marked as truncated rather than continued, and the errors are
+// returned.
+func (fs *fileStore) makeRoom() error {
+	if len(fs.files) < fs.opts.MaxOpenFiles {
+		return nil
+	}
+	var key fileKey
+	var lru *logFile
+	for k, f := range fs.files {
+		if lru == nil || f.used < lru.used {
+			key, lru = k, f
+		}
+	}
+	delete(fs.files, key)
+	if err := errors.Join(lru.Sync(), lru.Close()); err != nil {
+		fs.markTruncated(lru.Name())
+		fs.finish(lru.Name())
+		return fmt.Errorf("error closing %s: %w", lru.Name(), err)
+	}
+	e := evictedFile{Name: lru.Name(), Last: lru.Last, Part: lru.Part, Size: -1, Count: lru.Count, hash: lru.hash}
+	if info, err := os.Stat(lru.Name()); err == nil {
+		e.Size = info.Size()
+	}
+	fs.evicted[key] = e
+	return nil
+}
+
+// reopenEvicted opens the key's log file again if it was evicted by makeRoom.
+// It's opened as of when it was last written to, so that it's rotated out as
+// usual if the period has changed since.
+func (fs *fileStore) reopenEvicted(key fileKey) (*logFile, bool) {
+	e, ok := fs.evicted[key]
+	if !ok {
+		return nil, false
+	}
+	delete(fs.evicted, key)
+	if err := fs.makeRoom(); err != nil {
+		log.Println(err)
+	}
+	logfile, err := fs.continueEvicted(key, e)
+	if err != nil {
+		log.Println(err)
+		return nil, false
+	}
+	fs.files[key] = logfile
+	return logfile, true
+}
+
+// continueEvicted opens an evicted log file again, carrying on with the count
+// and hash it had. If the file was changed since, e.g. moved by logrotate, it's
+// opened like after a restart instead.
+func (fs *fileStore) continueEvicted(key fileKey, e evictedFile) (*logFile, error) {
+	file, err := os.OpenFile(e.Name, os.O_RDWR|os.O_APPEND, fs.opts.FileMode)
+	if err != nil {
+		return fs.openLogFile(key, e.Last, e.Part)
+	}
+	info, err := file.Stat()
+	if err != nil || info.Size() != e.Size {
+		file.Close()
+		return fs.openLogFile(key, e.Last, e.Part)
+	}
+	logfile := &logFile{
+		File:   file,
+		Period: fs.opts.PathTemplate.period(e.Last),
+		Part:   e.Part,
+		Size:   e.Size,
+		Last:   e.Last,
+		Count:  e.Count,
+		hash:   e.hash,
+	}
+	if err := fs.startWriting(logfile); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return logfile, nil
+}
+
+// truncatedMarker is created next to a log file that failed to be written to,
+// which may end in a truncated entry. Such files aren't continued.
+func truncatedMarker(name string) string {
+	return name + ".truncated"
+}
+
+// abandon closes a log file that failed to be written to, without writing out
+// what's still buffered, and marks it as possibly truncated. The next entry
+// for it starts a new part.
+func (fs *fileStore) abandon(key fileKey, f *logFile) {
+	log.Printf("%s may end in a truncated entry, continuing in a new file", f.Name())
+	fs.markTruncated(f.Name())
+	f.File.Close()
+	delete(fs.files, key)
+	fs.finish(f.Name())
+}
+
+// markTruncated creates the truncated marker of the log file.
+func (fs *fileStore) markTruncated(name string) {
+	marker, err := os.OpenFile(truncatedMarker(name), os.O_WRONLY|os.O_CREATE, fs.opts.FileMode)
+	if err != nil {
+		log.Println("error marking log file as truncated:", err)
+		return
+	}
+	marker.Close()
+}
+
+// flushLoop periodically flushes the log files, until fs.done is closed. It
+// holds fs.mu while it does, so flushes never happen halfway through an
+// entry.
+func (fs *fileStore) flushLoop() {
+	defer fs.loops.Done()
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fs.mu.Lock()
+			for key, file := range fs.files {
+				if err := file.Flush(); err != nil {
+					log.Println("error flushing log file:", err)
+					fs.abandon(key, file)
+				}
+			}
+			fs.mu.Unlock()
+		case <-fs.done:
+			return
+		}
+	}
+}
+
+// logfileName returns the name of a part of a log file. The first part is
+// named after the path template, and the parts after it have the part's number
+// before the extension. The template's .ndjson extension is replaced by the
+// format's, and files that are compressed with zstd have an additional .zst
+// extension.
+func (fs *fileStore) logfileName(key fileKey, t time.Time, part int) string {
+	template := fs.opts.PathTemplate
+	if key.DM {
+		template = template.dms()
+	}
+	name := strings.TrimSuffix(template.expand(t, key, fs.guildName(key)), ".ndjson")
+	if part > 0 {
+		name += "." + strconv.Itoa(part)
+	}
+	name += fs.opts.Format.ext()
+	if fs.opts.Compress == CompressZstd {
+		name += ".zst"
+	}
+	return filepath.Join(fs.path, name)
+}
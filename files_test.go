@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// openFiles counts the process's open file descriptors.
+func openFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("can't count open file descriptors:", err)
+	}
+	return len(fds)
+}
+
+func TestAppendKeepsLogFileOpen(t *testing.T) {
+	fs := newFileStore(t.TempDir(), Options{})
+	before := openFiles(t)
+	const n = 10
+	for i := 0; i < n; i++ {
+		r := Record{
+			Guild: 1,
+			Entry: Entry{Type: EntryMessage, Time: time.Now(), Data: json.RawMessage(`{}`)},
+		}
+		if err := fs.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if opened := openFiles(t) - before; opened != 1 {
+		t.Errorf("%d entries opened %d file descriptors, want 1", n, opened)
+	}
+	if len(fs.files) != 1 {
+		t.Errorf("%d files are kept open, want 1", len(fs.files))
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if left := openFiles(t) - before; left != 0 {
+		t.Errorf("%d file descriptors are left open after Close", left)
+	}
+}
+
+func TestAppendOpenFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// block puts something in the way of the log file.
+		block func(name string) error
+		msg   string
+		errno syscall.Errno
+	}{
+		{
+			"directory is a file",
+			func(name string) error {
+				os.MkdirAll(filepath.Dir(filepath.Dir(name)), 0o755)
+				return os.WriteFile(filepath.Dir(name), nil, 0o644)
+			},
+			"error creating log directory",
+			syscall.ENOTDIR,
+		},
+		{
+			"file is a directory",
+			func(name string) error { return os.MkdirAll(name, 0o755) },
+			"error opening log file",
+			syscall.EISDIR,
+		},
+	}
+	for _, test := range tests {
+		fs := newFileStore(t.TempDir(), Options{})
+		now := entryTime()
+		name := fs.logfileName(fileKey{Guild: 1}, now.In(fs.opts.RotationZone), 0)
+		if err := test.block(name); err != nil {
+			t.Fatal(err)
+		}
+		err := fs.Append(Record{Guild: 1, Entry: Entry{Type: EntryMessage, Time: now, Data: json.RawMessage(`{}`)}})
+		if !errors.Is(err, test.errno) {
+			t.Errorf("%s: got error %v, want one wrapping %v", test.name, err, test.errno)
+		} else if !strings.HasPrefix(err.Error(), test.msg+": ") {
+			t.Errorf("%s: got error %q, want it to start with %q", test.name, err, test.msg)
+		}
+		fs.Close()
+	}
+}
+
+// bigEntry is a record with more data than a log file's buffer holds, so that
+// appending it writes to the file.
+func bigEntry(gid discord.GuildID) Record {
+	data, _ := json.Marshal(strings.Repeat("a", logBufferSize))
+	return Record{Guild: gid, Entry: Entry{Version: EntryVersion, Type: EntryMessage, Time: entryTime(), Data: data}}
+}
+
+func TestAppendWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{})
+	appendEntries(t, fs, 1, 1)
+	first := fs.files[fileKey{Guild: 1}]
+	// Writing fails halfway through the entry once the file is gone.
+	first.File.Close()
+	err := fs.Append(bigEntry(1))
+	if !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("got error %v, want one wrapping %v", err, os.ErrClosed)
+	}
+	if !fileExists(truncatedMarker(first.Name())) {
+		t.Errorf("%s isn't marked as truncated", first.Name())
+	}
+	// The entries after it go in a new part.
+	appendEntries(t, fs, 1, 2)
+	second := fs.files[fileKey{Guild: 1}]
+	if second == nil || second.Name() == first.Name() {
+		t.Fatalf("entries after the failure still go in %s", first.Name())
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkTrailer(t, second.Name(), 2)
+}
+
+func TestSyncFailure(t *testing.T) {
+	fs := newFileStore(t.TempDir(), Options{Durability: Durability(time.Millisecond)})
+	appendEntries(t, fs, 1, 1)
+	fs.mu.Lock()
+	first := fs.files[fileKey{Guild: 1}]
+	first.File.Close()
+	fs.mu.Unlock()
+	waitFor(t, "the file that failed to be synced is abandoned", func() bool {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+		return fs.files[fileKey{Guild: 1}] == nil
+	})
+	if !fileExists(truncatedMarker(first.Name())) {
+		t.Errorf("%s isn't marked as truncated", first.Name())
+	}
+	appendEntries(t, fs, 1, 2)
+	fs.mu.Lock()
+	second := fs.files[fileKey{Guild: 1}]
+	fs.mu.Unlock()
+	if second == nil || second.Name() == first.Name() {
+		t.Fatalf("entries after the failure still go in %s", first.Name())
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkTrailer(t, second.Name(), 2)
+}
+
+func TestCloseReturnsErrors(t *testing.T) {
+	fs := newFileStore(t.TempDir(), Options{})
+	appendEntries(t, fs, 1, 1)
+	appendEntries(t, fs, 2, 1)
+	var names []string
+	for _, f := range fs.files {
+		names = append(names, f.Name())
+		f.File.Close()
+	}
+	err := fs.Close()
+	if !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("got error %v, want one wrapping %v", err, os.ErrClosed)
+	}
+	for _, name := range names {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q doesn't mention %s", err, name)
+		}
+		if !fileExists(truncatedMarker(name)) {
+			t.Errorf("%s isn't marked as truncated", name)
+		}
+	}
+}
+
+func TestEvictionFailure(t *testing.T) {
+	fs := newFileStore(t.TempDir(), Options{MaxOpenFiles: 1})
+	appendEntries(t, fs, 1, 1)
+	first := fs.files[fileKey{Guild: 1}]
+	first.File.Close()
+	// The first guild's file fails to be closed to make room for the
+	// second's, which is still written.
+	appendEntries(t, fs, 2, 1)
+	if !fileExists(truncatedMarker(first.Name())) {
+		t.Errorf("%s isn't marked as truncated", first.Name())
+	}
+	if _, ok := fs.evicted[fileKey{Guild: 1}]; ok {
+		t.Errorf("%s is still going to be continued", first.Name())
+	}
+	appendEntries(t, fs, 1, 1)
+	if f := fs.files[fileKey{Guild: 1}]; f.Name() == first.Name() {
+		t.Errorf("entries after the failure still go in %s", first.Name())
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoreGuildsThanMaxOpenFiles(t *testing.T) {
+	const (
+		max    = 2
+		guilds = 5
+		rounds = 3
+	)
+	for _, compress := range []Compression{CompressNone, CompressZstd} {
+		fs := newFileStore(t.TempDir(), Options{MaxOpenFiles: max, Compress: compress})
+		testMoreGuilds(t, fs, max, guilds, rounds)
+	}
+}
+
+func testMoreGuilds(t *testing.T, fs *fileStore, max, guilds, rounds int) {
+	t.Helper()
+	before := openFiles(t)
+	for i := 0; i < rounds; i++ {
+		for gid := discord.GuildID(1); gid <= discord.GuildID(guilds); gid++ {
+			appendEntries(t, fs, gid, 1)
+			if n := len(fs.files); n > max {
+				t.Fatalf("%d log files are open, want at most %d", n, max)
+			}
+			if opened := openFiles(t) - before; opened > max {
+				t.Fatalf("%d file descriptors are open, want at most %d", opened, max)
+			}
+		}
+	}
+	var names []string
+	for _, f := range fs.files {
+		names = append(names, f.Name())
+	}
+	for _, e := range fs.evicted {
+		names = append(names, e.Name)
+	}
+	if len(names) != guilds {
+		t.Fatalf("got log files %v, want one per guild", names)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		checkTrailer(t, name, rounds)
+	}
+}
+
+func TestEvictedFileMoved(t *testing.T) {
+	fs := newFileStore(t.TempDir(), Options{MaxOpenFiles: 1})
+	appendEntries(t, fs, 1, 2)
+	appendEntries(t, fs, 2, 1)
+	e, ok := fs.evicted[fileKey{Guild: 1}]
+	if !ok {
+		t.Fatal("the first guild's file wasn't closed to make room")
+	}
+	// The file is moved while it's closed, so the next entry starts over
+	// rather than carrying on with the count it had.
+	if err := os.Rename(e.Name, e.Name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendEntries(t, fs, 1, 1)
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkTrailer(t, e.Name, 1)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// GuildIDs is a set of guilds, given as a comma-separated list of IDs.
+type GuildIDs map[discord.GuildID]bool
+
+// String implements flag.Value.
+func (g GuildIDs) String() string {
+	return formatIDs(g)
+}
+
+// Set implements flag.Value.
+func (g *GuildIDs) Set(s string) error {
+	set, err := parseIDs[discord.GuildID](s, "guild")
+	*g = set
+	return err
+}
+
+// ChannelIDs is a set of channels, given as a comma-separated list of IDs.
+type ChannelIDs map[discord.ChannelID]bool
+
+// String implements flag.Value.
+func (c ChannelIDs) String() string {
+	return formatIDs(c)
+}
+
+// Set implements flag.Value.
+func (c *ChannelIDs) Set(s string) error {
+	set, err := parseIDs[discord.ChannelID](s, "channel")
+	*c = set
+	return err
+}
+
+func formatIDs[ID interface {
+	comparable
+	String() string
+}](set map[ID]bool) string {
+	var ids []string
+	for id := range set {
+		ids = append(ids, id.String())
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// parseIDs parses a comma-separated list of IDs. kind is what they are IDs
+// of, for errors.
+func parseIDs[ID ~uint64](s, kind string) (map[ID]bool, error) {
+	set := make(map[ID]bool)
+	for _, id := range strings.Split(s, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(id, 10, 64)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("invalid %s ID %q", kind, id)
+		}
+		set[ID(v)] = true
+	}
+	return set, nil
+}
+
+// guildFilter decides which guilds are logged. If include is empty, all
+// guilds are, except for the ones in exclude, which are never logged, even if
+// they are in include as well.
+type guildFilter struct {
+	include GuildIDs
+	exclude GuildIDs
+}
+
+func (f guildFilter) allows(id discord.GuildID) bool {
+	if !id.IsValid() || f.exclude[id] {
+		return false
+	}
+	return len(f.include) == 0 || f.include[id]
+}
+
+// channelFilter decides which channels of a guild are logged, like
+// guildFilter does for guilds. Threads are logged if their parent channel
+// is.
+type channelFilter struct {
+	include ChannelIDs
+	exclude ChannelIDs
+}
+
+// logsChannel returns whether the filter lets entries about the channel be
+// logged.
+func (l *Logger) logsChannel(f channelFilter, id discord.ChannelID) bool {
+	if f.include == nil && f.exclude == nil || !id.IsValid() {
+		return true
+	}
+	ids := []discord.ChannelID{id}
+	if ch, err := l.s.Cabinet.Channel(id); err == nil && isThread(ch.Type) {
+		ids = append(ids, ch.ParentID)
+	}
+	included := len(f.include) == 0
+	for _, id := range ids {
+		if f.exclude[id] {
+			return false
+		}
+		included = included || f.include[id]
+	}
+	return included
+}
+
+func isThread(t discord.ChannelType) bool {
+	switch t {
+	case discord.GuildAnnouncementThread, discord.GuildPublicThread, discord.GuildPrivateThread:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is how entries are encoded in log files. The zero value writes them
+// as JSON, one per line.
+type Format string
+
+const (
+	// FormatJSON writes entries as JSON, one per line, to .ndjson files.
+	FormatJSON Format = "ndjson"
+	// FormatProtobuf writes entries as length-delimited protobuf messages
+	// to .pb files, as described in entry.proto.
+	FormatProtobuf Format = "protobuf"
+	// FormatMsgpack writes entries as length-prefixed MessagePack to
+	// .msgpack files, as described in msgpack.go.
+	FormatMsgpack Format = "msgpack"
+)
+
+// formats are all the formats, for looking them up by extension.
+var formats = []Format{FormatJSON, FormatProtobuf, FormatMsgpack}
+
+// String implements flag.Value.
+func (f Format) String() string {
+	if f == "" {
+		return string(FormatJSON)
+	}
+	return string(f)
+}
+
+// Set implements flag.Value.
+func (f *Format) Set(s string) error {
+	switch v := Format(s); v {
+	case FormatJSON, FormatProtobuf, FormatMsgpack:
+		*f = v
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", s)
+	}
+}
+
+func (f Format) ext() string {
+	switch f {
+	case FormatProtobuf:
+		return ".pb"
+	case FormatMsgpack:
+		return ".msgpack"
+	default:
+		return ".ndjson"
+	}
+}
+
+// encode appends the encoded entry to buf.
+func (f Format) encode(buf *bytes.Buffer, e Entry) error {
+	switch f {
+	case FormatProtobuf:
+		return encodeProtobuf(buf, e)
+	case FormatMsgpack:
+		return encodeMsgpack(buf, e)
+	default:
+		return encodeJSON(buf, e)
+	}
+}
+
+// encodeJSON appends the entry as a line of JSON. It's written by hand rather
+// than by json.Encoder, which would scan Data again. Data has to be compact
+// JSON as json.Marshal returns it.
+func encodeJSON(buf *bytes.Buffer, e Entry) error {
+	typ, err := json.Marshal(e.Type)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(`{"v":`)
+	buf.Write(strconv.AppendInt(buf.AvailableBuffer(), int64(e.Version), 10))
+	buf.WriteString(`,"type":`)
+	buf.Write(typ)
+	buf.WriteString(`,"time":`)
+	if err := writeEntryTime(buf, e.Time); err != nil {
+		return err
+	}
+	if e.Seq != 0 {
+		buf.WriteString(`,"seq":`)
+		buf.Write(strconv.AppendUint(buf.AvailableBuffer(), e.Seq, 10))
+	}
+	if e.Guild != 0 {
+		g, _ := e.Guild.MarshalJSON()
+		buf.WriteString(`,"guild":`)
+		buf.Write(g)
+	}
+	buf.WriteString(`,"data":`)
+	if e.Data == nil {
+		buf.WriteString("null")
+	} else {
+		buf.Write(e.Data)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// entryTimeFormat is how the times of entries are written, with exactly three
+// fractional digits. The times are in UTC, which is written as Z.
+const entryTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// writeEntryTime writes the entry's time as a JSON string. Times of whole
+// milliseconds, as entryTime returns them, are written in entryTimeFormat.
+// Older entries' times may be more precise, and are written as time.Time
+// writes them, so that nothing is lost when they are converted.
+func writeEntryTime(buf *bytes.Buffer, t time.Time) error {
+	if t.Nanosecond()%int(time.Millisecond) != 0 {
+		b, err := t.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		return nil
+	}
+	buf.WriteByte('"')
+	buf.Write(t.AppendFormat(buf.AvailableBuffer(), entryTimeFormat))
+	buf.WriteByte('"')
+	return nil
+}
+
+// decoder returns a function that decodes the entries read from r one by
+// one. It returns io.EOF after the last one.
+func (f Format) decoder(r io.Reader) func(*Entry) error {
+	next := f.records(r)
+	return func(e *Entry) error {
+		rec, err := next()
+		if err != nil {
+			return err
+		}
+		if err := f.unmarshal(rec, e); err != nil {
+			return err
+		}
+		normalize(e)
+		return nil
+	}
+}
+
+// normalize changes entries of older versions to the shape that the current
+// version writes, where they differ in ways readers would trip over. It
+// returns whether the entry was changed. The entry's version is kept.
+func normalize(e *Entry) bool {
+	// Before version 2, the ID of channel entries was written as "author".
+	// It's the first field, so it's always at the start.
+	if e.Type == EntryChannel && e.Version < 2 {
+		if rest, ok := bytes.CutPrefix(e.Data, []byte(`{"author":`)); ok {
+			e.Data = append([]byte(`{"id":`), rest...)
+			return true
+		}
+	}
+	return false
+}
+
+// maxRecordSize is the longest length prefix that records accepts. Entries
+// are nowhere near as big, so longer ones can only come from corrupt files.
+const maxRecordSize = 64 << 20
+
+// errCorruptRecord is returned by records for length prefixes that can't have
+// been written by encode.
+var errCorruptRecord = errors.New("corrupt record")
+
+// records returns a function that returns the encoded entries read from r
+// one by one, as encode wrote them. It returns io.EOF after the last one,
+// io.ErrUnexpectedEOF if the last one is cut off, and errCorruptRecord if a
+// length prefix is invalid.
+func (f Format) records(r io.Reader) func() ([]byte, error) {
+	br := bufio.NewReader(r)
+	switch f {
+	case FormatProtobuf, FormatMsgpack:
+		return func() ([]byte, error) {
+			size, err := binary.ReadUvarint(br)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			if err != nil || size > maxRecordSize {
+				return nil, errCorruptRecord
+			}
+			// The record is read as far as it goes, rather than
+			// allocated up front, so that a length that runs past
+			// the end of the file doesn't allocate all of it.
+			rec := bytes.NewBuffer(binary.AppendUvarint(nil, size))
+			n := rec.Len()
+			if _, err := rec.ReadFrom(io.LimitReader(br, int64(size))); err != nil {
+				return nil, err
+			}
+			if rec.Len() < n+int(size) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return rec.Bytes(), nil
+		}
+	default:
+		return func() ([]byte, error) {
+			line, err := br.ReadBytes('\n')
+			if err == io.EOF && len(line) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return line, err
+		}
+	}
+}
+
+// unmarshal decodes an entry returned by records.
+func (f Format) unmarshal(rec []byte, e *Entry) error {
+	*e = Entry{}
+	switch f {
+	case FormatProtobuf, FormatMsgpack:
+		_, n := binary.Uvarint(rec)
+		if f == FormatProtobuf {
+			return decodeProtobuf(rec[n:], e)
+		}
+		return decodeMsgpack(rec[n:], e)
+	default:
+		return json.Unmarshal(rec, e)
+	}
+}
+
+// formatOf returns the format of the file, going by its extension.
+func formatOf(name string) (Format, bool) {
+	for _, f := range formats {
+		if strings.HasSuffix(name, f.ext()) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// convert implements the convert subcommand, which converts a log file to
+// another format. The formats are told by the files' extensions. The EOFEntry
+// is written anew if the file has one, since its hash is of the entries as
+// they were encoded in the original format. It's left out if the file doesn't
+// match it, so that the converted file doesn't pass verify.
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dislog convert <input> <output>")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	inFormat, ok := formatOf(fs.Arg(0))
+	if !ok {
+		return errors.New("unknown format of " + fs.Arg(0))
+	}
+	outFormat, ok := formatOf(fs.Arg(1))
+	if !ok {
+		return errors.New("unknown format of " + fs.Arg(1))
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(fs.Arg(1), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	next := inFormat.records(in)
+	var (
+		buf     bytes.Buffer
+		trailer *Entry
+		count   int
+		// inHash and h are the hashes of the entries as they're read
+		// and written.
+		inHash = sha256.New()
+		h      = sha256.New()
+	)
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		var e Entry
+		if err == nil {
+			err = inFormat.unmarshal(rec, &e)
+		}
+		if err != nil {
+			out.Close()
+			return fmt.Errorf("error reading %s: %w", fs.Arg(0), err)
+		}
+		if e.Type == EntryEOF {
+			trailer = &e
+			continue
+		}
+		normalize(&e)
+		inHash.Write(rec)
+		buf.Reset()
+		if err := outFormat.encode(&buf, e); err != nil {
+			out.Close()
+			return err
+		}
+		w.Write(buf.Bytes())
+		h.Write(buf.Bytes())
+		count++
+	}
+	var eof EOFEntry
+	if trailer != nil && (json.Unmarshal(trailer.Data, &eof) != nil ||
+		eof.Entries != count || eof.SHA256 != hex.EncodeToString(inHash.Sum(nil))) {
+		fmt.Fprintf(os.Stderr, "%s doesn't match its eof entry, leaving it out\n", fs.Arg(0))
+		trailer = nil
+	}
+	if trailer != nil {
+		data, err := json.Marshal(EOFEntry{
+			Entries: count,
+			SHA256:  hex.EncodeToString(h.Sum(nil)),
+		})
+		if err != nil {
+			out.Close()
+			return err
+		}
+		trailer.Data = data
+		buf.Reset()
+		if err := outFormat.encode(&buf, *trailer); err != nil {
+			out.Close()
+			return err
+		}
+		w.Write(buf.Bytes())
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// decode implements the decode subcommand, which writes the entries in a log
+// file to stdout as ndjson.
+func decode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dislog decode <file>")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	format, ok := formatOf(fs.Arg(0))
+	if !ok {
+		return errors.New("unknown format of " + fs.Arg(0))
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w := bufio.NewWriter(os.Stdout)
+	decode := format.decoder(in)
+	var buf bytes.Buffer
+	for {
+		var e Entry
+		err := decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Flush()
+			return fmt.Errorf("error reading %s: %w", fs.Arg(0), err)
+		}
+		buf.Reset()
+		FormatJSON.encode(&buf, e)
+		w.Write(buf.Bytes())
+	}
+	return w.Flush()
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// inZone runs the test with the local time zone set to one that isn't UTC.
+func inZone(t *testing.T) {
+	t.Helper()
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	t.Cleanup(func() { time.Local = local })
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	inZone(t)
+	want := Entry{
+		Version: EntryVersion,
+		Type:    EntryMessage,
+		Time:    time.Date(2024, 6, 3, 12, 0, 0, int(123*time.Millisecond), time.UTC),
+		Seq:     7,
+		Guild:   42,
+		Data:    json.RawMessage(`{"id":"1","content":"hello"}`),
+	}
+	var line bytes.Buffer
+	encodeJSON(&line, want)
+	for _, f := range formats {
+		var buf bytes.Buffer
+		if err := f.encode(&buf, want); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		var got Entry
+		if err := f.decoder(&buf)(&got); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+		if got.Time.Location() != time.UTC {
+			t.Errorf("%s: decoded time is in %s, want UTC", f, got.Time.Location())
+		}
+		var again bytes.Buffer
+		encodeJSON(&again, got)
+		if again.String() != line.String() {
+			t.Errorf("%s: round trip gave\n%s\nwant\n%s", f, again.String(), line.String())
+		}
+	}
+}
+
+func TestRecordsCorruptLength(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want error
+	}{
+		{"huge length", binary.AppendUvarint(nil, 1<<62), errCorruptRecord},
+		{"overflowing length", bytes.Repeat([]byte{0xff}, binary.MaxVarintLen64+1), errCorruptRecord},
+		{"length past the end", append(binary.AppendUvarint(nil, 1000), "abc"...), io.ErrUnexpectedEOF},
+	}
+	for _, f := range []Format{FormatProtobuf, FormatMsgpack} {
+		for _, test := range tests {
+			_, err := f.records(bytes.NewReader(test.in))()
+			if err != test.want {
+				t.Errorf("%s, %s: got error %v, want %v", f, test.name, err, test.want)
+			}
+		}
+	}
+}
+
+// benchEntry is a msg entry as appendEntry would write it.
+func benchEntry(b testing.TB) Entry {
+	data, err := json.Marshal(MessageEntry{
+		Author:    User{ID: 1, Tag: "user"},
+		ID:        10,
+		Channel:   Channel{ID: testChannel, Name: "general"},
+		Content:   "hello, this is a message of about the usual length",
+		Timestamp: discord.NewTimestamp(time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return Entry{
+		Version: EntryVersion,
+		Type:    EntryMessage,
+		Time:    time.Date(2024, 6, 3, 12, 0, 0, int(123*time.Millisecond), time.UTC),
+		Guild:   42,
+		Data:    data,
+	}
+}
+
+// plainEntry is an Entry without its MarshalJSON method, which json.Encoder
+// encodes the way entries were encoded before encodeJSON.
+type plainEntry Entry
+
+func TestEncodeJSONMatchesEncoder(t *testing.T) {
+	e := benchEntry(t)
+	var got, want bytes.Buffer
+	if err := encodeJSON(&got, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(&want).Encode(plainEntry(e)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("encodeJSON wrote\n%s\njson.Encoder wrote\n%s", got.String(), want.String())
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	e := benchEntry(b)
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := encodeJSON(&buf, e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncodeJSONEncoder encodes entries the way they were before
+// encodeJSON, to compare against BenchmarkEncodeJSON.
+func BenchmarkEncodeJSONEncoder(b *testing.B) {
+	e := plainEntry(benchEntry(b))
+	var buf bytes.Buffer
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := json.NewEncoder(&buf).Encode(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEntryTimeFormat(t *testing.T) {
+	inZone(t)
+	tests := []struct {
+		time time.Time
+		want string
+	}{
+		{time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC), `"2024-06-03T12:00:00.000Z"`},
+		{time.Date(2024, 6, 3, 12, 0, 0, int(120*time.Millisecond), time.UTC), `"2024-06-03T12:00:00.120Z"`},
+		// Older entries may be more precise, or not in UTC.
+		{time.Date(2024, 6, 3, 12, 0, 0, 123456789, time.UTC), `"2024-06-03T12:00:00.123456789Z"`},
+		{time.Date(2024, 6, 3, 14, 0, 0, 0, time.Local), `"2024-06-03T14:00:00.000+02:00"`},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := writeEntryTime(&buf, test.time); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.want {
+			t.Errorf("%v is written as %s, want %s", test.time, buf.String(), test.want)
+		}
+		var back time.Time
+		if err := json.Unmarshal(buf.Bytes(), &back); err != nil || !back.Equal(test.time) {
+			t.Errorf("%s is read back as %v (%v), want %v", buf.String(), back, err, test.time)
+		}
+	}
+	now := entryTime()
+	if now.Location() != time.UTC || now.Nanosecond()%int(time.Millisecond) != 0 {
+		t.Errorf("entryTime returned %v, want a time in UTC of whole milliseconds", now)
+	}
+}
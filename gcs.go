@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/oauth2/google"
+)
+
+// gcsArchive uploads log files to a Google Cloud Storage bucket, with the
+// application default credentials.
+type gcsArchive struct {
+	bucket string
+	client *http.Client
+}
+
+func newGCSArchive(bucket string) (*gcsArchive, error) {
+	client, err := google.DefaultClient(context.Background(),
+		"https://www.googleapis.com/auth/devstorage.read_write")
+	if err != nil {
+		return nil, fmt.Errorf("error finding credentials: %w", err)
+	}
+	return &gcsArchive{bucket: bucket, client: client}, nil
+}
+
+func (a *gcsArchive) String() string {
+	return "gs://" + a.bucket
+}
+
+func (a *gcsArchive) upload(ctx context.Context, key, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	u := "https://storage.googleapis.com/upload/storage/v1/b/" + url.PathEscape(a.bucket) +
+		"/o?uploadType=media&name=" + url.QueryEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %s: %s: %s", key, resp.Status, body)
+	}
+	return nil
+}
@@ -1,5 +1,21 @@
 module github.com/samhza/dislog
 
-go 1.14
+go 1.23
 
-require github.com/diamondburned/arikawa v1.3.1
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/diamondburned/arikawa/v3 v3.6.0
+	github.com/klauspost/compress v1.17.11
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.24
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/oauth2 v0.25.0
+)
+
+require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
+	github.com/gorilla/schema v1.4.1 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/time v0.10.0 // indirect
+)
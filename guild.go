@@ -0,0 +1,126 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// forgetGuild drops what's remembered about the guild once the bot was removed
+// from it, or it became unavailable.
+func (l *Logger) forgetGuild(id discord.GuildID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for sid, s := range l.stages {
+		if s.GuildID == id {
+			delete(l.stages, sid)
+		}
+	}
+	for eid, e := range l.events {
+		if e.GuildID == id {
+			delete(l.events, eid)
+		}
+	}
+}
+
+func (l *Logger) logGuildUpdateEvent(g *gateway.GuildUpdateEvent) {
+	entry := GuildUpdateEntry{
+		After: toGuild(g.Guild),
+	}
+	if prev, ok := l.previous(g).(*discord.Guild); ok {
+		l.logGuildBoost(*prev, g.Guild)
+		before := toGuild(*prev)
+		if before == entry.After {
+			return
+		}
+		entry.Before = &before
+	}
+	err := l.appendEntry(g.ID, EntryGuildUpdate, entry)
+	if err != nil {
+		log.Println("error while logging GuildUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildEmojisUpdateEvent(e *gateway.GuildEmojisUpdateEvent) {
+	var entry EmojisEntry
+	if prev, ok := l.previous(e).([]discord.Emoji); ok {
+		old := make(map[discord.EmojiID]discord.Emoji, len(prev))
+		for _, emoji := range prev {
+			old[emoji.ID] = emoji
+		}
+		for _, emoji := range e.Emojis {
+			o, ok := old[emoji.ID]
+			switch {
+			case !ok:
+				entry.Added = append(entry.Added, toEmoji(emoji))
+			case o.Name != emoji.Name:
+				entry.Renamed = append(entry.Renamed, EmojiRename{
+					ID:      emoji.ID,
+					OldName: o.Name,
+					Name:    emoji.Name,
+				})
+			}
+			delete(old, emoji.ID)
+		}
+		for _, emoji := range prev {
+			if _, ok := old[emoji.ID]; ok {
+				entry.Removed = append(entry.Removed, toEmoji(emoji))
+			}
+		}
+		if entry.Added == nil && entry.Removed == nil && entry.Renamed == nil {
+			return
+		}
+	} else {
+		entry.Snapshot = true
+		entry.Emojis = make([]Emoji, len(e.Emojis))
+		for i, emoji := range e.Emojis {
+			entry.Emojis[i] = toEmoji(emoji)
+		}
+	}
+	err := l.appendEntry(e.GuildID, EntryEmojis, entry)
+	if err != nil {
+		log.Println("error while logging GuildEmojisUpdateEvent:", err)
+	}
+}
+
+func toGuild(guild discord.Guild) Guild {
+	return Guild{
+		Name:         guild.Name,
+		Icon:         guild.Icon,
+		OwnerID:      guild.OwnerID,
+		Verification: guild.Verification,
+	}
+}
+
+// GuildUpdateEntry is written when the guild's settings change. Before is
+// only set if the guild was cached, in which case the entry is skipped if
+// none of the fields in Guild changed.
+type GuildUpdateEntry struct {
+	Before *Guild `json:"before,omitempty"`
+	After  Guild  `json:"after"`
+}
+
+type Guild struct {
+	Name         string               `json:"name"`
+	Icon         discord.Hash         `json:"icon"`
+	OwnerID      discord.UserID       `json:"owner"`
+	Verification discord.Verification `json:"verification"`
+}
+
+// EmojisEntry is written when the guild's custom emojis change. If the
+// previous emojis were cached, the entry lists what was added, removed and
+// renamed. Otherwise Snapshot is set and Emojis holds the new set of emojis.
+type EmojisEntry struct {
+	Added    []Emoji       `json:"added,omitempty"`
+	Removed  []Emoji       `json:"removed,omitempty"`
+	Renamed  []EmojiRename `json:"renamed,omitempty"`
+	Snapshot bool          `json:"snapshot,omitempty"`
+	Emojis   []Emoji       `json:"emojis,omitempty"`
+}
+
+type EmojiRename struct {
+	ID      discord.EmojiID `json:"id"`
+	OldName string          `json:"oldName"`
+	Name    string          `json:"name"`
+}
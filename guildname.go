@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// slugMaxLen is the most characters that a slug is made of, so that long
+// names don't run into file name limits.
+const slugMaxLen = 48
+
+// slug turns a guild's name into something that's safe to use as part of a
+// file name on any filesystem. Letters and digits are kept, in lower case,
+// and runs of anything else, e.g. spaces, punctuation, path separators,
+// control characters or emoji, become a single dash. Combining marks are
+// dropped, and fullwidth forms are replaced by their ASCII counterparts. It
+// returns "" if nothing is left of the name.
+func slug(name string) string {
+	var b strings.Builder
+	var n int
+	dash := false
+	for _, r := range name {
+		if r >= '\uff01' && r <= '\uff5e' {
+			r -= '\uff01' - '!'
+		}
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			dash = dash && n > 0
+			if dash && n+2 > slugMaxLen || n+1 > slugMaxLen {
+				return b.String()
+			}
+			if dash {
+				b.WriteByte('-')
+				n++
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+			n++
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// guildName returns the slug of the guild's name that follows its ID in
+// {guild}, or "" if guild names aren't used or the name isn't known.
+func (fs *fileStore) guildName(key fileKey) string {
+	if fs.opts.GuildName == nil || !key.Guild.IsValid() {
+		return ""
+	}
+	return slug(fs.opts.GuildName(key.Guild))
+}
@@ -0,0 +1,34 @@
+package main
+
+import "github.com/diamondburned/arikawa/v3/discord"
+
+// UserIDs is a set of users, given as a comma-separated list of IDs.
+type UserIDs map[discord.UserID]bool
+
+// String implements flag.Value.
+func (u UserIDs) String() string {
+	return formatIDs(u)
+}
+
+// Set implements flag.Value.
+func (u *UserIDs) Set(s string) error {
+	set, err := parseIDs[discord.UserID](s, "user")
+	*u = set
+	return err
+}
+
+// ignoresUser returns whether the user's messages, reactions and typing are
+// left out.
+func (l *Logger) ignoresUser(id discord.UserID, bot bool) bool {
+	f := l.filters.Load()
+	return f.IgnoreUsers[id] || bot && f.IgnoreBots
+}
+
+// ignoresMessage returns whether the message, its edits and its deletion are
+// left out, going by its author.
+func (l *Logger) ignoresMessage(m *discord.Message) bool {
+	if m.WebhookID.IsValid() {
+		return l.filters.Load().IgnoreWebhooks
+	}
+	return l.ignoresUser(m.Author.ID, m.Author.Bot)
+}
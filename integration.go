@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+// Like webhooks, the update event doesn't say what changed, so the current
+// integrations are only listed if enrichment is enabled.
+func (l *Logger) logGuildIntegrationsUpdateEvent(i *gateway.GuildIntegrationsUpdateEvent) {
+	entry := IntegrationsEntry{}
+	if l.opts.Enrich {
+		l.enrich(i.GuildID, EntryIntegrations, func(s *state.State) interface{} {
+			// The client waits out rate limits by itself, so only actual
+			// failures end up here.
+			integrations, err := s.Integrations(i.GuildID)
+			if err != nil {
+				log.Println("error while fetching integrations:", err)
+				return entry
+			}
+			entry.Integrations = make([]Integration, len(integrations))
+			for j, in := range integrations {
+				entry.Integrations[j] = toIntegration(in)
+			}
+			return entry
+		})
+		return
+	}
+	err := l.appendEntry(i.GuildID, EntryIntegrations, entry)
+	if err != nil {
+		log.Println("error while logging GuildIntegrationsUpdateEvent:", err)
+	}
+}
+
+func toIntegration(in discord.Integration) Integration {
+	integration := Integration{
+		ID:      in.ID,
+		Name:    in.Name,
+		Type:    in.Type,
+		Enabled: in.Enabled,
+	}
+	// Neither of these are set for every type of integration.
+	if in.User.ID.IsValid() {
+		user := toUser(in.User)
+		integration.User = &user
+	}
+	if in.Application != nil && in.Application.Bot.ID.IsValid() {
+		bot := toUser(in.Application.Bot)
+		integration.Bot = &bot
+	}
+	return integration
+}
+
+// IntegrationsEntry is written when a guild's integrations change.
+// Integrations is only set if enrichment is enabled and fetching them
+// succeeded.
+type IntegrationsEntry struct {
+	Integrations []Integration `json:"integrations,omitempty"`
+}
+
+// Integration is a guild integration. User is the user that added it, and Bot
+// is the bot user of bot integrations.
+type Integration struct {
+	ID      discord.IntegrationID `json:"id"`
+	Name    string                `json:"name"`
+	Type    discord.Service       `json:"type"`
+	Enabled bool                  `json:"enabled"`
+	User    *User                 `json:"user,omitempty"`
+	Bot     *User                 `json:"bot,omitempty"`
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EOFEntry is written as the last entry of a log file when it's rotated out or
+// closed. Entries is the number of entries before it, and SHA256 is the hash
+// of the bytes they were encoded to, before compression. Files that weren't
+// closed properly, e.g. because the process died, have none. An uncompressed
+// file that's continued after a restart has its EOFEntry taken off first.
+type EOFEntry struct {
+	Entries int    `json:"entries"`
+	SHA256  string `json:"sha256"`
+}
+
+// writeTrailer writes the file's EOFEntry. Nothing may be written to the file
+// after it.
+func (fs *fileStore) writeTrailer(f *logFile) error {
+	data, err := json.Marshal(EOFEntry{
+		Entries: f.Count,
+		SHA256:  hex.EncodeToString(f.hash.Sum(nil)),
+	})
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = fs.opts.Format.encode(&buf, Entry{
+		Version: EntryVersion,
+		Type:    EntryEOF,
+		Time:    entryTime(),
+		Data:    data,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	return err
+}
+
+// logScan is what scanLogFile found in a log file. Count is the number of
+// entries before the EOFEntry, Size how many bytes they were encoded to, and
+// Hash their hash. Trailer is the EOFEntry, if the file ends in one.
+type logScan struct {
+	Count   int
+	Size    int64
+	Hash    hash.Hash
+	Trailer *EOFEntry
+}
+
+// scanLogFile reads the entries in the log file.
+func scanLogFile(name string) (logScan, error) {
+	r, format, err := openLogReader(name)
+	if err != nil {
+		return logScan{}, err
+	}
+	defer r.Close()
+	s := logScan{Hash: sha256.New()}
+	next := format.records(r)
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return logScan{}, err
+		}
+		if s.Trailer != nil {
+			return logScan{}, errors.New("entries after the eof entry")
+		}
+		var e Entry
+		if err := format.unmarshal(rec, &e); err != nil {
+			return logScan{}, err
+		}
+		if e.Type == EntryEOF {
+			s.Trailer = new(EOFEntry)
+			if err := json.Unmarshal(e.Data, s.Trailer); err != nil {
+				return logScan{}, err
+			}
+			continue
+		}
+		s.Hash.Write(rec)
+		s.Size += int64(len(rec))
+		s.Count++
+	}
+}
+
+// openLogReader opens the log file for reading, decompressing it if it is
+// compressed, and returns the format it's in.
+func openLogReader(name string) (io.ReadCloser, Format, error) {
+	base := strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	format, ok := formatOf(base)
+	if !ok {
+		return nil, "", errors.New("unknown format of " + name)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, "", err
+		}
+		return readCloser{zr, f}, format, nil
+	case strings.HasSuffix(name, ".zst"):
+		zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			f.Close()
+			return nil, "", err
+		}
+		return readCloser{zr.IOReadCloser(), f}, format, nil
+	}
+	return f, format, nil
+}
+
+// readCloser reads from a decompressor, and closes it along with the file
+// it reads from.
+type readCloser struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r readCloser) Close() error {
+	r.ReadCloser.Close()
+	return r.f.Close()
+}
+
+// verify implements the verify subcommand, which checks the log files in a
+// directory against their EOFEntry, and lists the files that have none.
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: dislog verify [directory]")
+	}
+	fs.Parse(args)
+	dir := "dislog"
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	var bad int
+	err := filepath.WalkDir(dir, func(name string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Type()&os.ModeSymlink != 0 || !isLogFile(d.Name()) {
+			// Skip the symlinks in currentDir.
+			return nil
+		}
+		s, err := scanLogFile(name)
+		count, h, trailer := s.Count, s.Hash, s.Trailer
+		marker := truncatedMarker(strings.TrimSuffix(name, ".gz"))
+		switch {
+		case fileExists(marker):
+			fmt.Printf("%s: may end in a truncated entry, as writing to it failed (see %s)\n", name, marker)
+			bad++
+		case err != nil:
+			fmt.Printf("%s: %v\n", name, err)
+			bad++
+		case trailer == nil:
+			fmt.Printf("%s: no eof entry, the file is still open or wasn't closed properly\n", name)
+		case trailer.Entries != count:
+			fmt.Printf("%s: has %d entries, but should have %d\n", name, count, trailer.Entries)
+			bad++
+		case trailer.SHA256 != hex.EncodeToString(h.Sum(nil)):
+			fmt.Printf("%s: checksum mismatch\n", name)
+			bad++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d log files failed verification", bad)
+	}
+	return nil
+}
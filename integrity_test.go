@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// appendEntries appends n entries of the guild to the store.
+func appendEntries(t *testing.T, fs *fileStore, gid discord.GuildID, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		r := Record{
+			Guild: gid,
+			Entry: Entry{
+				Version: EntryVersion,
+				Type:    EntryMessage,
+				Time:    entryTime(),
+				Data:    json.RawMessage(`{"content":"hello"}`),
+			},
+		}
+		if err := fs.Append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// logFiles returns the log files in the directory, leaving out currentDir.
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	filepath.WalkDir(dir, func(name string, d os.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() && isLogFile(d.Name()) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}
+
+// checkTrailer fails the test unless the log file ends in an EOFEntry that
+// matches the n entries before it.
+func checkTrailer(t *testing.T, name string, n int) {
+	t.Helper()
+	s, err := scanLogFile(name)
+	switch {
+	case err != nil:
+		t.Errorf("%s: %v", name, err)
+	case s.Trailer == nil:
+		t.Errorf("%s has no eof entry", name)
+	case s.Count != n || s.Trailer.Entries != n:
+		t.Errorf("%s has %d entries and an eof entry for %d, want %d", name, s.Count, s.Trailer.Entries, n)
+	case s.Trailer.SHA256 != hex.EncodeToString(s.Hash.Sum(nil)):
+		t.Errorf("%s: checksum mismatch", name)
+	}
+}
+
+func TestCloseWritesTrailer(t *testing.T) {
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{})
+	appendEntries(t, fs, 1, 3)
+	fs.Close()
+	files := logFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("got log files %v, want one", files)
+	}
+	checkTrailer(t, files[0], 3)
+
+	// The file is continued after a restart, with the eof entry moved to
+	// its new end.
+	fs = newFileStore(dir, Options{})
+	appendEntries(t, fs, 1, 2)
+	fs.Close()
+	if again := logFiles(t, dir); len(again) != 1 {
+		t.Fatalf("got log files %v after a restart, want only %s", again, files[0])
+	}
+	checkTrailer(t, files[0], 5)
+}
+
+func TestCloseWritesTrailerCompressed(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{Compress: CompressZstd}
+	fs := newFileStore(dir, opts)
+	appendEntries(t, fs, 1, 3)
+	fs.Close()
+	// Compressed files can't have their eof entry taken off, so they're
+	// continued in a new part.
+	fs = newFileStore(dir, opts)
+	appendEntries(t, fs, 1, 2)
+	fs.Close()
+	files := logFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("got log files %v, want two parts", files)
+	}
+	var total int
+	for _, name := range files {
+		s, _ := scanLogFile(name)
+		checkTrailer(t, name, s.Count)
+		total += s.Count
+	}
+	if total != 5 {
+		t.Errorf("the parts have %d entries, want 5", total)
+	}
+}
+
+func TestReopenWritesTrailer(t *testing.T) {
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{MaxOpenFiles: 1})
+	appendEntries(t, fs, 1, 2)
+	// The first guild's file is closed to make room for the second's.
+	appendEntries(t, fs, 2, 1)
+	if n, err := fs.Reopen(); err != nil || n != 2 {
+		t.Errorf("Reopen closed %d files with error %v, want 2 and none", n, err)
+	}
+	for _, name := range logFiles(t, dir) {
+		s, _ := scanLogFile(name)
+		checkTrailer(t, name, s.Count)
+	}
+	fs.Close()
+}
+
+func TestAppendAfterCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{Format: FormatProtobuf})
+	appendEntries(t, fs, 1, 1)
+	first := fs.files[fileKey{Guild: 1}].Name()
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A length prefix that claims far more than the file holds.
+	f, err := os.OpenFile(first, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(binary.AppendUvarint(nil, 1<<62))
+	f.Close()
+	fs = newFileStore(dir, Options{Format: FormatProtobuf})
+	appendEntries(t, fs, 1, 1)
+	second := fs.files[fileKey{Guild: 1}].Name()
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Fatalf("entries are still appended to %s", first)
+	}
+	checkTrailer(t, second, 1)
+}
+
+func TestConvertWritesNewTrailer(t *testing.T) {
+	dir := t.TempDir()
+	fs := newFileStore(dir, Options{})
+	appendEntries(t, fs, 1, 3)
+	fs.Close()
+	orig := logFiles(t, dir)[0]
+	pb := filepath.Join(dir, "converted.pb")
+	back := filepath.Join(dir, "back.ndjson")
+	if err := convert([]string{orig, pb}); err != nil {
+		t.Fatal(err)
+	}
+	if err := convert([]string{pb, back}); err != nil {
+		t.Fatal(err)
+	}
+	checkTrailer(t, pb, 3)
+	checkTrailer(t, back, 3)
+	a, _ := os.ReadFile(orig)
+	b, _ := os.ReadFile(back)
+	if string(a) != string(b) {
+		t.Errorf("converting to protobuf and back gave\n%s\nwant\n%s", b, a)
+	}
+}
+
+func TestConvertDropsMismatchedTrailer(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.ndjson")
+	out := filepath.Join(dir, "out.pb")
+	lines := `{"v":3,"type":"msg","time":"2024-06-03T12:00:00.000Z","data":{}}` + "\n" +
+		`{"v":3,"type":"eof","time":"2024-06-03T12:00:00.000Z","data":{"entries":2,"sha256":"00"}}` + "\n"
+	os.WriteFile(in, []byte(lines), 0o644)
+	if err := convert([]string{in, out}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := scanLogFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Trailer != nil || s.Count != 1 {
+		t.Errorf("converted file has %d entries and eof entry %+v, want 1 entry and none", s.Count, s.Trailer)
+	}
+}
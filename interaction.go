@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// Discord only sends interactions to the application they belong to, so
+// these are only the interactions with this bot's own commands and
+// components.
+func (l *Logger) logInteractionCreateEvent(i *gateway.InteractionCreateEvent) {
+	var user User
+	if sender := i.Sender(); sender != nil {
+		user = toUser(*sender)
+	}
+	switch data := i.Data.(type) {
+	case *discord.CommandInteraction:
+		entry := CommandEntry{
+			User:    user,
+			Channel: l.toChannel(i.ChannelID),
+			Name:    data.Name,
+			Options: toCommandOptions(data.Options),
+			Target:  data.TargetID,
+		}
+		err := l.appendEntry(i.GuildID, EntryCommand, entry)
+		if err != nil {
+			log.Println("error while logging InteractionCreateEvent:", err)
+		}
+	case discord.ComponentInteraction:
+		if !l.opts.Components {
+			return
+		}
+		entry := ComponentEntry{
+			User:     user,
+			Channel:  l.toChannel(i.ChannelID),
+			Type:     componentTypeName(data.Type()),
+			CustomID: data.ID(),
+			Values:   componentValues(data),
+		}
+		if i.Message != nil {
+			entry.Message = i.Message.ID
+		}
+		err := l.appendEntry(i.GuildID, EntryComponent, entry)
+		if err != nil {
+			log.Println("error while logging InteractionCreateEvent:", err)
+		}
+	}
+}
+
+func toCommandOptions(opts discord.CommandInteractionOptions) []CommandOption {
+	if len(opts) == 0 {
+		return nil
+	}
+	options := make([]CommandOption, len(opts))
+	for i, opt := range opts {
+		options[i] = CommandOption{
+			Name:    opt.Name,
+			Value:   json.RawMessage(opt.Value),
+			Options: toCommandOptions(opt.Options),
+		}
+	}
+	return options
+}
+
+// componentValues returns the values chosen in a select menu, or nil for
+// other components.
+func componentValues(data discord.ComponentInteraction) []string {
+	var values []string
+	switch data := data.(type) {
+	case *discord.StringSelectInteraction:
+		values = data.Values
+	case *discord.ChannelSelectInteraction:
+		for _, id := range data.Values {
+			values = append(values, id.String())
+		}
+	case *discord.RoleSelectInteraction:
+		for _, id := range data.Values {
+			values = append(values, id.String())
+		}
+	case *discord.UserSelectInteraction:
+		for _, id := range data.Values {
+			values = append(values, id.String())
+		}
+	case *discord.MentionableSelectInteraction:
+		for _, id := range data.Values {
+			values = append(values, id.String())
+		}
+	}
+	return values
+}
+
+// CommandEntry is written when an application command is used. Target is the
+// user or message that user and message commands were used on.
+type CommandEntry struct {
+	User    User              `json:"user"`
+	Channel Channel           `json:"channel"`
+	Name    string            `json:"name"`
+	Options []CommandOption   `json:"options,omitempty"`
+	Target  discord.Snowflake `json:"target,omitempty"`
+}
+
+// CommandOption is an argument given to a command. Subcommands and subcommand
+// groups have Options instead of a Value.
+type CommandOption struct {
+	Name    string          `json:"name"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Options []CommandOption `json:"options,omitempty"`
+}
+
+// ComponentEntry is written when a message component, e.g. a button or a
+// select menu, is used.
+type ComponentEntry struct {
+	User     User                `json:"user"`
+	Channel  Channel             `json:"channel"`
+	Message  discord.MessageID   `json:"message,omitempty"`
+	Type     string              `json:"type"`
+	CustomID discord.ComponentID `json:"customID"`
+	Values   []string            `json:"values,omitempty"`
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logInviteCreateEvent(i *gateway.InviteCreateEvent) {
+	entry := InviteEntry{
+		Action:    ActionCreate,
+		Code:      i.Code,
+		Channel:   l.toChannel(i.ChannelID),
+		MaxUses:   i.MaxUses,
+		Temporary: i.Temporary,
+	}
+	if i.Inviter != nil {
+		inviter := toUser(*i.Inviter)
+		entry.Inviter = &inviter
+	}
+	if i.MaxAge > 0 {
+		expires := i.CreatedAt.Time().Add(i.MaxAge.Duration()).UTC()
+		entry.Expires = &expires
+	}
+	l.rememberInvite(entry)
+	err := l.appendEntry(i.GuildID, EntryInvite, entry)
+	if err != nil {
+		log.Println("error while logging InviteCreateEvent:", err)
+	}
+}
+
+// The delete event only carries the invite's code and channel, so the rest
+// is filled in from the invite's creation if it was seen.
+func (l *Logger) logInviteDeleteEvent(i *gateway.InviteDeleteEvent) {
+	l.mu.Lock()
+	entry, ok := l.invites[i.Code]
+	delete(l.invites, i.Code)
+	l.mu.Unlock()
+	if !ok {
+		entry = InviteEntry{
+			Code:    i.Code,
+			Channel: l.toChannel(i.ChannelID),
+		}
+	}
+	entry.Action = ActionDelete
+	err := l.appendEntry(i.GuildID, EntryInvite, entry)
+	if err != nil {
+		log.Println("error while logging InviteDeleteEvent:", err)
+	}
+}
+
+// maxInvites bounds how many invites are remembered for when they're deleted.
+const maxInvites = 8192
+
+// rememberInvite keeps the invite's entry for its deletion. Discord doesn't
+// send a delete event for invites that expire, so once there are maxInvites,
+// the expired ones are forgotten, and an arbitrary one if none expired.
+func (l *Logger) rememberInvite(entry InviteEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.invites) >= maxInvites {
+		now := time.Now()
+		for code, inv := range l.invites {
+			if inv.Expires != nil && !inv.Expires.After(now) {
+				delete(l.invites, code)
+			}
+		}
+		evictArbitrary(l.invites, maxInvites-1)
+	}
+	l.invites[entry.Code] = entry
+}
+
+// InviteEntry is written when an invite is created or deleted. Expires is
+// unset for invites that never expire, and MaxUses is 0 for invites with
+// unlimited uses.
+type InviteEntry struct {
+	Action    Action     `json:"action"`
+	Code      string     `json:"code"`
+	Inviter   *User      `json:"inviter,omitempty"`
+	Channel   Channel    `json:"channel"`
+	MaxUses   int        `json:"maxUses"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Temporary bool       `json:"temporary,omitempty"`
+}
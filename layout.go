@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// Layout is how entries are split into log files. The zero value puts each
+// guild's entries in a file of its own.
+type Layout string
+
+const (
+	// LayoutGuild writes each guild's entries to <period>/<guild>.ndjson.
+	LayoutGuild Layout = "guild"
+	// LayoutChannel writes the entries of each channel to
+	// <period>/<guild>/<channel>.ndjson, and the entries that aren't about
+	// a channel to <period>/<guild>/_guild.ndjson.
+	LayoutChannel Layout = "channel"
+	// LayoutCombined writes the entries of all guilds to
+	// <period>/all.ndjson, with the guild set on each entry.
+	LayoutCombined Layout = "combined"
+)
+
+// String implements flag.Value.
+func (l Layout) String() string {
+	if l == "" {
+		return string(LayoutGuild)
+	}
+	return string(l)
+}
+
+// Set implements flag.Value.
+func (l *Layout) Set(s string) error {
+	switch v := Layout(s); v {
+	case LayoutGuild, LayoutChannel, LayoutCombined:
+		*l = v
+		return nil
+	default:
+		return fmt.Errorf("unknown layout %q", s)
+	}
+}
+
+// fileKey identifies a log file within a period. Guild is only set if the path
+// template has {guild}, and Channel for entries about a channel, if it has
+// {channel}. DM is set for direct messages, along with their Channel.
+type fileKey struct {
+	Guild   discord.GuildID
+	Channel discord.ChannelID
+	DM      bool
+}
+
+// template returns the name of a log file within the period's directory, as
+// part of a PathTemplate.
+func (l Layout) template() string {
+	switch l {
+	case LayoutChannel:
+		return "{guild}/{channel}"
+	case LayoutCombined:
+		return "all"
+	default:
+		return "{guild}"
+	}
+}
+
+// channelScoped is implemented by entries that are about a single channel.
+type channelScoped interface {
+	channelID() discord.ChannelID
+}
+
+func (e MessageEntry) channelID() discord.ChannelID           { return e.Channel.ID }
+func (e MessageEditEntry) channelID() discord.ChannelID       { return e.Channel.ID }
+func (e MessageDeleteEntry) channelID() discord.ChannelID     { return e.Channel.ID }
+func (e MessageDeleteBulkEntry) channelID() discord.ChannelID { return e.Channel.ID }
+func (e PublishedEntry) channelID() discord.ChannelID         { return e.Channel.ID }
+func (e ReactionEntry) channelID() discord.ChannelID          { return e.Channel.ID }
+func (e ReactionClearEntry) channelID() discord.ChannelID     { return e.Channel.ID }
+func (e PinsEntry) channelID() discord.ChannelID              { return e.Channel.ID }
+func (e TypingEntry) channelID() discord.ChannelID            { return e.Channel.ID }
+func (e WebhooksEntry) channelID() discord.ChannelID          { return e.Channel.ID }
+func (e InviteEntry) channelID() discord.ChannelID            { return e.Channel.ID }
+func (e CommandEntry) channelID() discord.ChannelID           { return e.Channel.ID }
+func (e ComponentEntry) channelID() discord.ChannelID         { return e.Channel.ID }
+func (e ChannelEntry) channelID() discord.ChannelID           { return e.ID }
+func (e ChannelMoveEntry) channelID() discord.ChannelID       { return e.Channel.ID }
+func (e SlowmodeEntry) channelID() discord.ChannelID          { return e.Channel.ID }
+func (e ThreadEntry) channelID() discord.ChannelID            { return e.ID }
+func (e StageEntry) channelID() discord.ChannelID             { return e.Channel.ID }
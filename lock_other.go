@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lockDir does nothing on platforms without flock.
+func lockDir(path string, dirMode, fileMode os.FileMode) (release func(), err error) {
+	return func() {}, nil
+}
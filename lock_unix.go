@@ -0,0 +1,35 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDir takes an exclusive lock on the directory, so that two instances
+// don't write to the same log files. The lock is held until release is
+// called, or until the process exits, however it exits.
+func lockDir(path string, dirMode, fileMode os.FileMode) (release func(), err error) {
+	if err := os.MkdirAll(path, dirMode); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+	name := filepath.Join(path, ".lock")
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		f.Close()
+		return nil, fmt.Errorf("another instance is already logging to %s", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking %s: %w", name, err)
+	}
+	return func() { f.Close() }, nil
+}
@@ -1,106 +1,607 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/diamondburned/arikawa/bot/extras/infer"
-	"github.com/diamondburned/arikawa/discord"
-	"github.com/diamondburned/arikawa/gateway"
-	"github.com/diamondburned/arikawa/state"
-	"github.com/diamondburned/arikawa/utils/wsutil"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/handler"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
 )
 
+// A Logger logs the events it's handed to its Store. Its methods are safe for
+// concurrent use, up until Close is called.
 type Logger struct {
-	path  string
+	store Store
 	s     *state.State
-	files map[discord.GuildID]*logFile
+	opts  Options
+
+	// pending tracks the background REST calls started by enrich.
+	pending sync.WaitGroup
+
+	prevMu sync.Mutex
+	prev   map[interface{}]interface{}
+
+	// mu guards the state that's kept between events, from voice to
+	// events. It's never held while an entry is logged, since that can
+	// wait for room in a write queue.
+	mu sync.Mutex
+
+	voice map[discord.GuildID]map[discord.UserID]*voiceSession
+
+	typing map[typingKey]time.Time
+
+	invites map[string]InviteEntry
+
+	// tags holds the last seen tag of every user, to detect renames.
+	tags map[discord.UserID]string
+
+	stages map[discord.StageID]StageInstance
+	events map[discord.EventID]discord.GuildScheduledEvent
+
+	// channels caches the names of channels for toChannel.
+	channels channelNames
+
+	// replays detects the message events that the gateway sent again.
+	replays replays
+
+	// filters holds the Filters in use, which are replaced as a whole.
+	filters atomic.Pointer[Filters]
+
+	// queues hold the entries waiting to be written by the writers.
+	// dropped counts the entries that were dropped because their queue
+	// was full, and failed the times that writing failed even after
+	// retrying.
+	queues  []chan queuedRecord
+	queueMu []sync.Mutex
+	writers sync.WaitGroup
+	dropped atomic.Int64
+	failed  atomic.Int64
+	// stopping is closed when the writers are being stopped.
+	stopping chan struct{}
 }
 
-func NewLogger(s *state.State, path string) *Logger {
-	return &Logger{path: path, s: s}
+// Options configures the optional parts of a Logger. The zero value only logs
+// the events that are logged by default.
+type Options struct {
+	// Typing enables logging of typing indicators.
+	Typing bool
+	// Presence enables logging of presence updates. If PresenceTransitions
+	// is also set, updates are only logged if the user's status changed.
+	Presence            bool
+	PresenceTransitions bool
+	// Enrich enables fetching extra details for some entries over REST.
+	Enrich bool
+	// Components enables logging of message component interactions, e.g.
+	// button clicks.
+	Components bool
+	// AuthorMember enables recording the nickname and roles of message
+	// authors.
+	AuthorMember bool
+	// Rotation is how often log files are rotated.
+	Rotation Rotation
+	// RotationZone is the time zone that periods begin and end in. nil
+	// means UTC.
+	RotationZone *time.Location
+	// MaxSize is the size in bytes after which a log file is continued in a
+	// new file within the same period. 0 means no limit.
+	MaxSize int64
+	// Format is how entries are encoded in log files.
+	Format Format
+	// Compress is how log files are compressed.
+	Compress Compression
+	// Retention is how long log files are kept after they were last
+	// written to. 0 means forever. If RetentionDryRun is set, expired
+	// files are only listed instead of removed.
+	Retention       time.Duration
+	RetentionDryRun bool
+	// GuildRetention holds the retention periods of the guilds that
+	// have their own, which only apply if the path template has {guild}.
+	GuildRetention map[discord.GuildID]time.Duration
+	// Archive is where log files are uploaded to once they are rotated
+	// out. If DeleteArchived is set, they are removed after the upload.
+	Archive        archive
+	DeleteArchived bool
+	// Durability is when log files are synced to disk.
+	Durability Durability
+	// Layout is how entries are split into log files.
+	Layout Layout
+	// PathTemplate is where log files are written. If set, it takes the
+	// place of Rotation and Layout.
+	PathTemplate PathTemplate
+	// DirMode and FileMode are the permissions that directories and files
+	// are created with, subject to the umask. 0 means 0700 and 0600.
+	// Directories and files that already exist keep the permissions they
+	// have, so that changing the modes doesn't undo permissions that were
+	// set by hand; they have to be changed with chmod.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// GuildName, if set, returns the name of a guild, or "" if it isn't
+	// known. A slug of it is added to the guild's ID in the names of log
+	// files, when they are opened. Files that are already open keep their
+	// name until they are rotated out.
+	GuildName func(discord.GuildID) string
+	// DeadLetters, if set, keeps the entries that couldn't be encoded or
+	// written.
+	DeadLetters *deadLetters
+	// Sequences, if set, numbers the entries of each guild.
+	Sequences *sequences
+	// Filters decide what is logged. They can be changed later with
+	// Logger.SetFilters.
+	Filters Filters
+	// DMs enables logging of direct messages, including those in group
+	// DMs. They're written to files of their own, as described by
+	// PathTemplate.dms, or with Guild unset in the other stores.
+	DMs bool
+	// MaxOpenFiles is how many log files are kept open at most. The
+	// least recently written one is closed to make room, and continued
+	// when it's written to again. 0 means 256.
+	MaxOpenFiles int
+	// Writers is how many goroutines write entries to the store, and
+	// QueueSize is how many entries each of them queues. 0 means 4 and
+	// 1024. When a queue is full, logging waits for room in it, unless
+	// DropWhenFull is set, which drops the entry and counts it instead.
+	Writers      int
+	QueueSize    int
+	DropWhenFull bool
+	// WriteRetries is how many times writing an entry is retried before
+	// OnWriteFailure is done.
+	WriteRetries   int
+	OnWriteFailure WriteFailure
 }
 
-func (l *Logger) Close() {
-	for _, file := range l.files {
-		file.Sync()
-		file.Close()
-	}
+// Filters decide which events are logged.
+type Filters struct {
+	// Guilds are the guilds that are logged.
+	Guilds guildFilter
+	// Entries are the types of entries that are logged. nil means all of
+	// them.
+	Entries EntryTypes
+	// Categories are the categories of entries that are logged, on top of
+	// Entries. nil means all of them.
+	Categories Categories
+	// Redact leaves out the content of messages.
+	Redact bool
+	// IgnoreBots, IgnoreWebhooks and IgnoreUsers leave out the messages of
+	// bots, webhooks and the given users, along with their edits and
+	// deletions. The reactions and typing of ignored users are left out as
+	// well.
+	IgnoreBots     bool
+	IgnoreWebhooks bool
+	IgnoreUsers    UserIDs
+	// Overrides are the filters of the guilds that have filters of their
+	// own. Any filters that a guild doesn't override have to be copied
+	// from the ones above.
+	Overrides map[discord.GuildID]GuildFilters
 }
 
-type logFile struct {
-	*os.File
-	Year int
-	Week int
+// GuildFilters are the filters that apply to a single guild.
+type GuildFilters struct {
+	Entries EntryTypes
+	// Channels filters the channels that are logged. Entries that aren't
+	// about a channel are always logged.
+	Channels channelFilter
+	Redact   bool
 }
 
-func (l *Logger) appendEntry(gid discord.GuildID, etype EntryType, data interface{}) error {
-	now := time.Now()
-	year, week := now.ISOWeek()
-	logfile, ok := l.files[gid]
-	if logfile != nil {
-		if logfile.Year != year || logfile.Week != week {
-			ok = false
-		}
+// guild returns the filters that apply to the guild.
+func (f *Filters) guild(id discord.GuildID) GuildFilters {
+	if g, ok := f.Overrides[id]; ok {
+		return g
 	}
+	return GuildFilters{Entries: f.Entries, Redact: f.Redact}
+}
+
+func NewLogger(s *state.State, store Store, opts Options) *Logger {
+	l := &Logger{
+		store:   store,
+		s:       s,
+		opts:    opts,
+		prev:    make(map[interface{}]interface{}),
+		voice:   make(map[discord.GuildID]map[discord.UserID]*voiceSession),
+		typing:  make(map[typingKey]time.Time),
+		invites: make(map[string]InviteEntry),
+		tags:    make(map[discord.UserID]string),
+		stages:  make(map[discord.StageID]StageInstance),
+		events:  make(map[discord.EventID]discord.GuildScheduledEvent),
+	}
+	l.SetFilters(opts.Filters)
+	l.startWriters()
+	return l
+}
+
+// SetFilters replaces the Logger's filters. It's safe to call while events
+// are being handled.
+func (l *Logger) SetFilters(f Filters) {
+	l.filters.Store(&f)
+}
+
+// LogsGuild returns whether the guild's events are logged.
+func (l *Logger) LogsGuild(id discord.GuildID) bool {
+	return l.filters.Load().Guilds.allows(id)
+}
+
+// Reopen reopens the store's files, if it has any. It's safe to call while
+// events are being handled.
+func (l *Logger) Reopen() {
+	r, ok := l.store.(reopener)
 	if !ok {
-		if logfile != nil {
-			logfile.Sync()
-			logfile.Close()
-		}
-		name := l.logfileName(uint64(gid), now)
-		err := os.MkdirAll(filepath.Dir(name), 0700)
-		if err != nil {
-			return fmt.Errorf("error creating log directory: %w", err)
-		}
-		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
-		if err != nil {
-			return fmt.Errorf("error opening log file: %w")
-		}
-		logfile = &logFile{
-			file, year, week,
+		return
+	}
+	n, err := r.Reopen()
+	if err != nil {
+		log.Println("error reopening log files:", err)
+	}
+	log.Printf("reopened %d log files", n)
+}
+
+// Close ends the open voice sessions, writes out the queued entries and closes
+// the store. It must be called once no more events are being handled, and the
+// Logger can't be used after it.
+func (l *Logger) Close() {
+	l.closeVoiceSessions()
+	l.pending.Wait()
+	l.stopWriters()
+	if l.opts.Sequences != nil {
+		if err := l.opts.Sequences.close(); err != nil {
+			log.Println("error saving sequence numbers:", err)
 		}
 	}
+	if err := l.store.Close(); err != nil {
+		log.Println("error closing store:", err)
+	}
+}
+
+func (l *Logger) appendEntry(gid discord.GuildID, etype EntryType, data interface{}) error {
+	filters := l.filters.Load()
+	f := filters.guild(gid)
+	if !f.Entries.has(etype) || !filters.Categories.has(etype) {
+		return nil
+	}
+	if c, ok := data.(channelScoped); ok && !l.logsChannel(f.Channels, c.channelID()) {
+		return nil
+	}
+	if r, ok := data.(redactable); ok && f.Redact {
+		data = r.redacted()
+	}
+	return l.writeEntry(gid, etype, data)
+}
+
+// writeEntry queues the entry to be written, regardless of the filters.
+func (l *Logger) writeEntry(gid discord.GuildID, etype EntryType, data interface{}) error {
 	entry := Entry{
-		Type: etype,
-		Time: now,
+		Version: EntryVersion,
+		Type:    etype,
+		Time:    entryTime(),
 	}
 	b, err := json.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("Logger.appendEntry: failed to Marshal data: %w", err)
+		err = fmt.Errorf("Logger.appendEntry: failed to Marshal data: %w", err)
+		l.deadLetter(gid, entry, data, err)
+		return err
 	}
 	entry.Data = json.RawMessage(b)
-	enc := json.NewEncoder(logfile)
-	enc.Encode(entry)
+	r := Record{Guild: gid, Entry: entry}
+	if c, ok := data.(channelScoped); ok {
+		r.Channel = c.channelID()
+	}
+	if m, ok := data.(messageScoped); ok {
+		r.Message = m.messageID()
+	}
+	if a, ok := data.(authored); ok {
+		r.Author = a.authorID()
+	}
+	l.enqueue(r, data)
 	return nil
 }
 
-func (l *Logger) logfileName(id uint64, t time.Time) string {
-	year, week := t.ISOWeek()
-	return filepath.Join(l.path, fmt.Sprintf("%d-%d/%d.ndjson", year, week, id))
+// deadLetter keeps the entry that failed with err, if dead letters are
+// enabled.
+func (l *Logger) deadLetter(gid discord.GuildID, e Entry, data interface{}, err error) {
+	if l.opts.DeadLetters != nil {
+		l.opts.DeadLetters.add(e, gid, data, err)
+	}
+}
+
+// enrichTimeout bounds the REST calls made by enrich.
+const enrichTimeout = 10 * time.Second
+
+// enrich calls fetch in the background and logs the entry it returns, so that
+// slow REST calls don't hold up the event loop. If fetch returns nil, nothing
+// is logged.
+func (l *Logger) enrich(gid discord.GuildID, etype EntryType, fetch func(*state.State) interface{}) {
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+		defer cancel()
+		entry := fetch(l.s.WithContext(ctx))
+		if entry == nil {
+			return
+		}
+		err := l.appendEntry(gid, etype, entry)
+		if err != nil {
+			log.Printf("error while logging %s entry: %v", etype, err)
+		}
+	}()
 }
 
+// HandleEvent logs the event. Message events that were handled already, which
+// the gateway may send again after resuming a session, are skipped.
+//
+// It may be called from multiple goroutines at once, but events that are
+// handled at the same time are logged in no particular order. Events are
+// handed to it one at a time by main, so that their entries are in the order
+// the gateway sent them.
 func (l *Logger) HandleEvent(e interface{}) {
+	l.channels.update(e)
+	if l.replays.replayed(e) {
+		l.Forget(e)
+		return
+	}
 	switch e := e.(type) {
 	case *gateway.MessageCreateEvent:
 		l.logMessageCreateEvent(e)
+	case *gateway.MessageUpdateEvent:
+		l.logMessageUpdateEvent(e)
+	case *gateway.MessageDeleteEvent:
+		l.logMessageDeleteEvent(e)
+	case *gateway.MessageDeleteBulkEvent:
+		l.logMessageDeleteBulkEvent(e)
+	case *gateway.MessageReactionAddEvent:
+		l.logMessageReactionAddEvent(e)
+	case *gateway.MessageReactionRemoveEvent:
+		l.logMessageReactionRemoveEvent(e)
+	case *gateway.MessageReactionRemoveAllEvent:
+		l.logMessageReactionRemoveAllEvent(e)
+	case *gateway.MessageReactionRemoveEmojiEvent:
+		l.logMessageReactionRemoveEmojiEvent(e)
+	case *gateway.GuildMemberAddEvent:
+		l.logGuildMemberAddEvent(e)
+	case *gateway.GuildMemberRemoveEvent:
+		l.logGuildMemberRemoveEvent(e)
+	case *gateway.GuildMemberUpdateEvent:
+		l.logGuildMemberUpdateEvent(e)
+	case *gateway.GuildBanAddEvent:
+		l.logGuildBanAddEvent(e)
+	case *gateway.GuildBanRemoveEvent:
+		l.logGuildBanRemoveEvent(e)
+	case *gateway.ChannelCreateEvent:
+		l.logChannelCreateEvent(e)
+	case *gateway.ChannelUpdateEvent:
+		l.logChannelUpdateEvent(e)
+	case *gateway.ChannelDeleteEvent:
+		l.logChannelDeleteEvent(e)
+	case *gateway.GuildRoleCreateEvent:
+		l.logGuildRoleCreateEvent(e)
+	case *gateway.GuildRoleUpdateEvent:
+		l.logGuildRoleUpdateEvent(e)
+	case *gateway.GuildRoleDeleteEvent:
+		l.logGuildRoleDeleteEvent(e)
+	case *gateway.VoiceStateUpdateEvent:
+		l.logVoiceStateUpdateEvent(e)
+	case *gateway.GuildCreateEvent:
+		l.handleGuildCreateEvent(e)
+	case *gateway.GuildUpdateEvent:
+		l.logGuildUpdateEvent(e)
+	case *gateway.GuildDeleteEvent:
+		l.forgetGuild(e.ID)
+	case *gateway.TypingStartEvent:
+		l.logTypingStartEvent(e)
+	case *gateway.PresenceUpdateEvent:
+		l.logPresenceUpdateEvent(e)
+	case *gateway.InviteCreateEvent:
+		l.logInviteCreateEvent(e)
+	case *gateway.InviteDeleteEvent:
+		l.logInviteDeleteEvent(e)
+	case *gateway.WebhooksUpdateEvent:
+		l.logWebhooksUpdateEvent(e)
+	case *gateway.GuildEmojisUpdateEvent:
+		l.logGuildEmojisUpdateEvent(e)
+	case *gateway.ChannelPinsUpdateEvent:
+		l.logChannelPinsUpdateEvent(e)
+	case *gateway.ThreadCreateEvent:
+		l.logThreadCreateEvent(e)
+	case *gateway.ThreadUpdateEvent:
+		l.logThreadUpdateEvent(e)
+	case *gateway.ThreadDeleteEvent:
+		l.logThreadDeleteEvent(e)
+	case *gateway.ThreadListSyncEvent:
+		l.logThreadListSyncEvent(e)
+	case *gateway.GuildIntegrationsUpdateEvent:
+		l.logGuildIntegrationsUpdateEvent(e)
+	case *StageInstanceCreateEvent:
+		l.logStageInstanceCreateEvent(e)
+	case *StageInstanceUpdateEvent:
+		l.logStageInstanceUpdateEvent(e)
+	case *StageInstanceDeleteEvent:
+		l.logStageInstanceDeleteEvent(e)
+	case *gateway.GuildScheduledEventCreateEvent:
+		l.logGuildScheduledEventCreateEvent(e)
+	case *gateway.GuildScheduledEventUpdateEvent:
+		l.logGuildScheduledEventUpdateEvent(e)
+	case *gateway.GuildScheduledEventDeleteEvent:
+		l.logGuildScheduledEventDeleteEvent(e)
+	case *gateway.GuildScheduledEventUserAddEvent:
+		l.logGuildScheduledEventUserAddEvent(e)
+	case *gateway.GuildScheduledEventUserRemoveEvent:
+		l.logGuildScheduledEventUserRemoveEvent(e)
+	case *gateway.InteractionCreateEvent:
+		l.logInteractionCreateEvent(e)
 	}
 }
 
+// Snapshot saves the cached state that the event is about to overwrite, so
+// that HandleEvent can log what changed. It must be called before the state
+// handles the event, i.e. from a synchronous state PreHandler.
+func (l *Logger) Snapshot(e interface{}) {
+	var prev interface{}
+	switch e := e.(type) {
+	case *gateway.GuildMemberUpdateEvent:
+		m, err := l.s.Cabinet.Member(e.GuildID, e.User.ID)
+		if err != nil {
+			return
+		}
+		prev = m
+	case *gateway.MessageUpdateEvent:
+		m, err := l.s.Cabinet.Message(e.ChannelID, e.ID)
+		if err != nil {
+			return
+		}
+		prev = m
+	case *gateway.MessageDeleteEvent:
+		m, err := l.s.Cabinet.Message(e.ChannelID, e.ID)
+		if err != nil {
+			return
+		}
+		prev = m
+	case *gateway.MessageDeleteBulkEvent:
+		var msgs []discord.Message
+		for _, id := range e.IDs {
+			m, err := l.s.Cabinet.Message(e.ChannelID, id)
+			if err == nil {
+				msgs = append(msgs, *m)
+			}
+		}
+		if len(msgs) == 0 {
+			return
+		}
+		prev = msgs
+	case *gateway.ChannelUpdateEvent:
+		ch, err := l.s.Cabinet.Channel(e.ID)
+		if err != nil {
+			return
+		}
+		prev = ch
+	case *gateway.GuildRoleUpdateEvent:
+		r, err := l.s.Cabinet.Role(e.GuildID, e.Role.ID)
+		if err != nil {
+			return
+		}
+		prev = r
+	case *gateway.GuildRoleDeleteEvent:
+		r, err := l.s.Cabinet.Role(e.GuildID, e.RoleID)
+		if err != nil {
+			return
+		}
+		prev = r
+	case *gateway.VoiceStateUpdateEvent:
+		vs, err := l.s.Cabinet.VoiceState(e.GuildID, e.UserID)
+		if err != nil {
+			return
+		}
+		prev = vs
+	case *gateway.GuildUpdateEvent:
+		g, err := l.s.Cabinet.Guild(e.ID)
+		if err != nil {
+			return
+		}
+		prev = g
+	case *gateway.GuildEmojisUpdateEvent:
+		emojis, err := l.s.Cabinet.Emojis(e.GuildID)
+		if err != nil {
+			return
+		}
+		prev = emojis
+	case *gateway.PresenceUpdateEvent:
+		if !l.opts.Presence {
+			return
+		}
+		p, err := l.s.Cabinet.Presence(e.GuildID, e.User.ID)
+		if err != nil {
+			return
+		}
+		prev = p
+	case *gateway.ThreadUpdateEvent:
+		ch, err := l.s.Cabinet.Channel(e.ID)
+		if err != nil {
+			return
+		}
+		prev = ch
+	case *gateway.ThreadDeleteEvent:
+		ch, err := l.s.Cabinet.Channel(e.ID)
+		if err != nil {
+			return
+		}
+		prev = ch
+	default:
+		return
+	}
+	l.prevMu.Lock()
+	l.prev[e] = prev
+	l.prevMu.Unlock()
+}
+
+// Forget forgets the snapshot taken for an event that won't be handled, e.g.
+// because it was dropped.
+func (l *Logger) Forget(e interface{}) {
+	l.previous(e)
+}
+
+// previous returns and forgets the snapshot taken for the event, or nil if
+// there is none.
+func (l *Logger) previous(e interface{}) interface{} {
+	l.prevMu.Lock()
+	defer l.prevMu.Unlock()
+	prev, ok := l.prev[e]
+	if ok {
+		delete(l.prev, e)
+	}
+	return prev
+}
+
 func (l *Logger) logMessageCreateEvent(m *gateway.MessageCreateEvent) {
+	if l.ignoresMessage(&m.Message) {
+		return
+	}
 	entry := MessageEntry{
 		Author:          toUser(m.Author),
 		ID:              m.ID,
 		Channel:         l.toChannel(m.ChannelID),
 		Content:         m.Content,
 		Timestamp:       m.Timestamp,
-		EditedTimestamp: m.EditedTimestamp,
+		EditedTimestamp: optionalTimestamp(m.EditedTimestamp),
+		Attachments:     toAttachments(m.Attachments),
+		Embeds:          toEmbeds(m.Embeds),
+		Stickers:        toStickers(m.Stickers),
+		ReplyTo:         l.replyTo(m.Message),
+		Mentions:        l.mentions(m.Message),
+		TTS:             m.TTS,
+		Pinned:          m.Pinned,
+		Components:      toComponents(m.Components),
+		Type:            m.Type,
+		System:          systemMessage(m.Message),
+	}
+	// Flags are null rather than 0 when there are none.
+	if m.Flags > 0 {
+		entry.Flags = m.Flags
+	}
+	// Webhook authors aren't real users. Their name is picked per message,
+	// and their discriminator is always 0000.
+	if m.WebhookID.IsValid() {
+		entry.WebhookID = m.WebhookID
+		entry.Author.Tag = m.Author.Username
+	} else if m.GuildID.IsValid() {
+		// Renames and members are tracked per guild, which direct
+		// messages have none of.
+		l.trackTag(m.GuildID, m.Author)
+		if l.opts.AuthorMember {
+			entry.Member = l.authorMember(m)
+		}
 	}
 	err := l.appendEntry(m.GuildID, EntryMessage, entry)
 	if err != nil {
@@ -108,56 +609,435 @@ func (l *Logger) logMessageCreateEvent(m *gateway.MessageCreateEvent) {
 	}
 }
 
+func (l *Logger) logMessageUpdateEvent(m *gateway.MessageUpdateEvent) {
+	entry := MessageEditEntry{
+		ID:              m.ID,
+		Channel:         l.toChannel(m.ChannelID),
+		Content:         m.Content,
+		EditedTimestamp: optionalTimestamp(m.EditedTimestamp),
+		Embeds:          toEmbeds(m.Embeds),
+		Components:      toComponents(m.Components),
+	}
+	prev, cached := l.previous(m).(*discord.Message)
+	// Partial updates have no author, so go by the cached message if
+	// there is one.
+	if cached && l.ignoresMessage(prev) || m.Author.ID.IsValid() && l.ignoresMessage(&m.Message) {
+		return
+	}
+	if cached && !hasFlag(prev.Flags, discord.CrosspostedMessage) &&
+		hasFlag(m.Flags, discord.CrosspostedMessage) {
+		l.logMessagePublished(m)
+	}
+	// Updates that don't carry an edit timestamp weren't made by the author,
+	// e.g. embeds being attached to the message after a link unfurled. They
+	// also lack the author and content, so mark them as partial.
+	if !m.EditedTimestamp.IsValid() {
+		entry.Partial = true
+	} else {
+		entry.Author = toUser(m.Author)
+		if cached {
+			entry.OldContent = &prev.Content
+		}
+	}
+	err := l.appendEntry(m.GuildID, EntryMessageEdit, entry)
+	if err != nil {
+		log.Println("error while logging MessageUpdateEvent:", err)
+	}
+}
+
+// logMessagePublished logs an announcement being crossposted to the channels
+// that follow its channel.
+func (l *Logger) logMessagePublished(m *gateway.MessageUpdateEvent) {
+	entry := PublishedEntry{
+		ID:      m.ID,
+		Channel: l.toChannel(m.ChannelID),
+	}
+	err := l.appendEntry(m.GuildID, EntryPublished, entry)
+	if err != nil {
+		log.Println("error while logging published message:", err)
+	}
+}
+
+func (l *Logger) logMessageDeleteEvent(m *gateway.MessageDeleteEvent) {
+	entry := MessageDeleteEntry{
+		ID:      m.ID,
+		Channel: l.toChannel(m.ChannelID),
+	}
+	if prev, ok := l.previous(m).(*discord.Message); ok {
+		if l.ignoresMessage(prev) {
+			return
+		}
+		entry.Cached = true
+		cached := toCachedMessage(*prev)
+		entry.Message = &cached
+	}
+	err := l.appendEntry(m.GuildID, EntryMessageDelete, entry)
+	if err != nil {
+		log.Println("error while logging MessageDeleteEvent:", err)
+	}
+}
+
+func (l *Logger) logMessageDeleteBulkEvent(m *gateway.MessageDeleteBulkEvent) {
+	entry := MessageDeleteBulkEntry{
+		IDs:     m.IDs,
+		Count:   len(m.IDs),
+		Channel: l.toChannel(m.ChannelID),
+	}
+	if prev, ok := l.previous(m).([]discord.Message); ok {
+		ignored := make(map[discord.MessageID]bool)
+		for _, msg := range prev {
+			if l.ignoresMessage(&msg) {
+				ignored[msg.ID] = true
+				continue
+			}
+			entry.Messages = append(entry.Messages, toCachedMessage(msg))
+		}
+		if len(ignored) > 0 {
+			entry.IDs = nil
+			for _, id := range m.IDs {
+				if !ignored[id] {
+					entry.IDs = append(entry.IDs, id)
+				}
+			}
+			if len(entry.IDs) == 0 {
+				return
+			}
+			entry.Count = len(entry.IDs)
+		}
+	}
+	err := l.appendEntry(m.GuildID, EntryMessageDeleteBulk, entry)
+	if err != nil {
+		log.Println("error while logging MessageDeleteBulkEvent:", err)
+	}
+}
+
+func (l *Logger) logMessageReactionAddEvent(r *gateway.MessageReactionAddEvent) {
+	var user User
+	if r.Member != nil {
+		user = toUser(r.Member.User)
+	} else {
+		user = l.userFromID(r.GuildID, r.UserID)
+	}
+	if l.ignoresUser(user.ID, user.Bot) {
+		return
+	}
+	entry := ReactionEntry{
+		User:      user,
+		MessageID: r.MessageID,
+		Channel:   l.toChannel(r.ChannelID),
+		Emoji:     toEmoji(r.Emoji),
+	}
+	err := l.appendEntry(r.GuildID, EntryReactionAdd, entry)
+	if err != nil {
+		log.Println("error while logging MessageReactionAddEvent:", err)
+	}
+}
+
+func (l *Logger) logMessageReactionRemoveEvent(r *gateway.MessageReactionRemoveEvent) {
+	user := l.userFromID(r.GuildID, r.UserID)
+	if l.ignoresUser(user.ID, user.Bot) {
+		return
+	}
+	entry := ReactionEntry{
+		User:      user,
+		MessageID: r.MessageID,
+		Channel:   l.toChannel(r.ChannelID),
+		Emoji:     toEmoji(r.Emoji),
+	}
+	err := l.appendEntry(r.GuildID, EntryReactionRemove, entry)
+	if err != nil {
+		log.Println("error while logging MessageReactionRemoveEvent:", err)
+	}
+}
+
+func (l *Logger) logMessageReactionRemoveAllEvent(r *gateway.MessageReactionRemoveAllEvent) {
+	entry := ReactionClearEntry{
+		MessageID: r.MessageID,
+		Channel:   l.toChannel(r.ChannelID),
+	}
+	err := l.appendEntry(r.GuildID, EntryReactionRemoveAll, entry)
+	if err != nil {
+		log.Println("error while logging MessageReactionRemoveAllEvent:", err)
+	}
+}
+
+func (l *Logger) logMessageReactionRemoveEmojiEvent(r *gateway.MessageReactionRemoveEmojiEvent) {
+	emoji := toEmoji(r.Emoji)
+	entry := ReactionClearEntry{
+		MessageID: r.MessageID,
+		Channel:   l.toChannel(r.ChannelID),
+		Emoji:     &emoji,
+	}
+	err := l.appendEntry(r.GuildID, EntryReactionRemoveEmoji, entry)
+	if err != nil {
+		log.Println("error while logging MessageReactionRemoveEmojiEvent:", err)
+	}
+}
+
 func toUser(user discord.User) User {
+	tag := user.Username
+	// Users that migrated to unique usernames have a discriminator of "0".
+	if user.Discriminator != "" && user.Discriminator != "0" {
+		tag = fmt.Sprintf("%s#%s", user.Username, user.Discriminator)
+	}
 	return User{
 		ID:  user.ID,
-		Tag: fmt.Sprintf("%s#%s", user.Username, user.Discriminator),
+		Tag: tag,
+		Bot: user.Bot,
+	}
+}
+
+// evictArbitrary deletes arbitrary keys from the map until it has at most max
+// of them.
+func evictArbitrary[K comparable, V any](m map[K]V, max int) {
+	for k := range m {
+		if len(m) <= max {
+			return
+		}
+		delete(m, k)
+	}
+}
+
+// userFromID looks up the member in the state cache, falling back to a User
+// with only the ID set.
+func (l *Logger) userFromID(gid discord.GuildID, uid discord.UserID) User {
+	m, err := l.s.Cabinet.Member(gid, uid)
+	if err != nil {
+		return User{ID: uid}
+	}
+	return toUser(m.User)
+}
+
+func toEmoji(emoji discord.Emoji) Emoji {
+	return Emoji{
+		ID:   emoji.ID,
+		Name: emoji.Name,
 	}
 }
 
 func (l *Logger) toChannel(cid discord.ChannelID) Channel {
 	channel := Channel{ID: cid}
-	ch, err := l.s.Channel(cid)
-	if err == nil {
-		channel.Name = ch.Name
+	if name, ok := l.channels.get(cid); ok {
+		channel.Name = name
+		return channel
+	}
+	ch, err := l.s.Cabinet.Channel(cid)
+	if err != nil {
+		// Leave the name out rather than wait for the API.
+		l.fetchChannel(cid)
+		return channel
 	}
+	channel.Name = ch.Name
+	l.channels.set(cid, ch.Name)
 	return channel
 }
 
 type EntryType string
 
 const (
-	EntryMessage       EntryType = "msg"
-	EntryMessageDelete EntryType = "delmsg"
-	EntryChannel       EntryType = "chan"
+	EntryMessage             EntryType = "msg"
+	EntryMessageEdit         EntryType = "editmsg"
+	EntryMessageDelete       EntryType = "delmsg"
+	EntryMessageDeleteBulk   EntryType = "bulkdel"
+	EntryReactionAdd         EntryType = "reactadd"
+	EntryReactionRemove      EntryType = "reactdel"
+	EntryReactionRemoveAll   EntryType = "reactdelall"
+	EntryReactionRemoveEmoji EntryType = "reactdelemoji"
+	EntryChannel             EntryType = "chan"
+	EntryMemberJoin          EntryType = "memberjoin"
+	EntryMemberLeave         EntryType = "memberleave"
+	EntryMemberUpdate        EntryType = "memberupdate"
+	EntryBan                 EntryType = "ban"
+	EntryUnban               EntryType = "unban"
+	EntryRole                EntryType = "role"
+	EntryVoice               EntryType = "voice"
+	EntryVoiceSession        EntryType = "voicesession"
+	EntryGuildUpdate         EntryType = "guildupdate"
+	EntryTyping              EntryType = "typing"
+	EntryPresence            EntryType = "presence"
+	EntryInvite              EntryType = "invite"
+	EntryWebhooks            EntryType = "webhooks"
+	EntryEmojis              EntryType = "emojis"
+	EntryPins                EntryType = "pins"
+	EntryThread              EntryType = "thread"
+	EntryIntegrations        EntryType = "integrations"
+	EntryRename              EntryType = "rename"
+	EntryStage               EntryType = "stage"
+	EntryScheduledEvent      EntryType = "scheduledevent"
+	EntryRSVP                EntryType = "rsvp"
+	EntryCommand             EntryType = "command"
+	EntryComponent           EntryType = "component"
+	EntryGuildBoost          EntryType = "guildboost"
+	EntryBoost               EntryType = "boost"
+	EntryChannelMove         EntryType = "chanmove"
+	EntrySlowmode            EntryType = "slowmode"
+	EntryPublished           EntryType = "published"
+	EntryEOF                 EntryType = "eof"
+)
+
+// Action describes what happened to the subject of an entry that covers
+// several kinds of changes.
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+
+	ActionArchive   Action = "archive"
+	ActionUnarchive Action = "unarchive"
+	ActionSync      Action = "sync"
 )
 
+// EntryVersion is the version of the entries' data that is written. It's
+// increased whenever the shape of an entry's data changes, so that readers
+// can tell them apart. Entries written before versions were introduced have
+// none, which reads as 0.
+//
+// Version 2 fixed the ID of ChannelEntry being written as "author" instead of
+// "id". The decode, convert and dump subcommands rename it when reading older
+// entries, see normalize.
+//
+// Version 3 left out the timestamps that aren't set, e.g. the editedTimestamp
+// of messages that weren't edited, which were written as null before.
+const EntryVersion = 3
+
+// Entry is a line in a log file. Guild is only set in files that are shared
+// by all guilds. Time is when the entry was written, as entryTime returns it.
+// Seq is the entry's sequence number within its guild, see sequences. It's
+// unset for EOF entries.
 type Entry struct {
-	Type EntryType       `json:"type"`
-	Time time.Time       `json:"time"`
-	Data json.RawMessage `json:"data"`
+	Version int             `json:"v"`
+	Type    EntryType       `json:"type"`
+	Time    time.Time       `json:"time"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Guild   discord.GuildID `json:"guild,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// MarshalJSON encodes the entry as it's written to .ndjson files, so that the
+// other stores write its time the same way.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, e); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// entryTime returns the time of an entry written now. It's in UTC and
+// truncated to milliseconds, so that all entries are written the same way
+// wherever dislog runs. Log files are rotated by it as well, so an entry's
+// time always falls in its file's period.
+func entryTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
 
+// MessageEntry is written for every new message. Flags is the message's
+// discord.MessageFlags bitfield, e.g. marking crossposts. WebhookID is set for
+// messages sent through webhooks, in which case Author is the name the
+// message was sent with. Type is the discord.MessageType, and System describes
+// known types of system messages.
 type MessageEntry struct {
-	Author          User              `json:"author"`
-	ID              discord.MessageID `json:"id"`
-	Channel         Channel           `json:"channel"`
-	Content         string            `json:"content"`
-	Timestamp       discord.Timestamp `json:"time"`
-	EditedTimestamp discord.Timestamp `json:"editedTimestamp"`
+	Author          User                 `json:"author"`
+	ID              discord.MessageID    `json:"id"`
+	Channel         Channel              `json:"channel"`
+	Content         string               `json:"content"`
+	Redacted        bool                 `json:"redacted,omitempty"`
+	Timestamp       discord.Timestamp    `json:"time"`
+	EditedTimestamp *discord.Timestamp   `json:"editedTimestamp,omitempty"`
+	Attachments     []Attachment         `json:"attachments,omitempty"`
+	Embeds          []Embed              `json:"embeds,omitempty"`
+	Stickers        []Sticker            `json:"stickers,omitempty"`
+	ReplyTo         *Reply               `json:"replyTo,omitempty"`
+	Mentions        *Mentions            `json:"mentions,omitempty"`
+	TTS             bool                 `json:"tts,omitempty"`
+	Pinned          bool                 `json:"pinned,omitempty"`
+	Flags           discord.MessageFlags `json:"flags,omitempty"`
+	WebhookID       discord.WebhookID    `json:"webhookID,omitempty"`
+	Member          *AuthorMember        `json:"member,omitempty"`
+	Components      [][]Component        `json:"components,omitempty"`
+	Type            discord.MessageType  `json:"type,omitempty"`
+	System          string               `json:"system,omitempty"`
+}
+
+// MessageEditEntry is written for every update to a message. Partial is set
+// for updates that weren't edits by the author, in which case Author and
+// Content are left empty. Embeds and Components are the message's embeds and
+// components after the update. OldContent is only set if the message was
+// cached.
+type MessageEditEntry struct {
+	Author          User               `json:"author"`
+	ID              discord.MessageID  `json:"id"`
+	Channel         Channel            `json:"channel"`
+	Content         string             `json:"content"`
+	EditedTimestamp *discord.Timestamp `json:"editedTimestamp,omitempty"`
+	OldContent      *string            `json:"oldContent,omitempty"`
+	Redacted        bool               `json:"redacted,omitempty"`
+	Partial         bool               `json:"partial,omitempty"`
+	Embeds          []Embed            `json:"embeds,omitempty"`
+	Components      [][]Component      `json:"components,omitempty"`
+}
+
+type PublishedEntry struct {
+	ID      discord.MessageID `json:"id"`
+	Channel Channel           `json:"channel"`
+}
+
+// MessageDeleteEntry is written for every deleted message. Message is the
+// deleted message as it was cached, and is only set if Cached is.
+type MessageDeleteEntry struct {
+	ID      discord.MessageID `json:"id"`
+	Channel Channel           `json:"channel"`
+	Cached  bool              `json:"cached"`
+	Message *CachedMessage    `json:"message,omitempty"`
+}
+
+// MessageDeleteBulkEntry is written once for every bulk deletion, no matter
+// how many messages it covers. Messages holds the deleted messages that were
+// cached.
+type MessageDeleteBulkEntry struct {
+	IDs      []discord.MessageID `json:"ids"`
+	Count    int                 `json:"count"`
+	Channel  Channel             `json:"channel"`
+	Messages []CachedMessage     `json:"messages,omitempty"`
 }
 
-type MessageDeleteEntry discord.MessageID
+type ReactionEntry struct {
+	User      User              `json:"user"`
+	MessageID discord.MessageID `json:"message"`
+	Channel   Channel           `json:"channel"`
+	Emoji     Emoji             `json:"emoji"`
+}
 
+// ReactionClearEntry is written when reactions are removed from a message in
+// bulk. Emoji is only set if only the reactions for that emoji were removed.
+type ReactionClearEntry struct {
+	MessageID discord.MessageID `json:"message"`
+	Channel   Channel           `json:"channel"`
+	Emoji     *Emoji            `json:"emoji,omitempty"`
+}
+
+// ChannelEntry is written when a channel is created, updated or deleted. For
+// updates, OldName and OldTopic are set if the previous version of the
+// channel was cached, and Overwrites then lists the permission overwrites
+// that changed.
 type ChannelEntry struct {
-	ID    discord.ChannelID `json:"author"`
-	Name  string            `json:"name"`
-	Topic string            `json:"topic"`
+	ID       discord.ChannelID `json:"id"`
+	Action   Action            `json:"action"`
+	Type     string            `json:"type"`
+	Name     string            `json:"name"`
+	Topic    string            `json:"topic"`
+	OldName  *string           `json:"oldName,omitempty"`
+	OldTopic *string           `json:"oldTopic,omitempty"`
+
+	Overwrites []OverwriteChange `json:"overwrites,omitempty"`
 }
 
 type User struct {
 	ID  discord.UserID `json:"id"`
-	Tag string         `json:"tag"`
+	Tag string         `json:"tag,omitempty"`
+	Bot bool           `json:"bot,omitempty"`
 }
 
 type Channel struct {
@@ -165,48 +1045,328 @@ type Channel struct {
 	Name string            `json:"name"`
 }
 
+// Emoji is a unicode emoji if ID is unset, or a custom emoji otherwise.
+type Emoji struct {
+	ID   discord.EmojiID `json:"id,omitempty"`
+	Name string          `json:"name"`
+}
+
+// intents returns the gateway intents needed for the events that are logged
+// with the given options.
+func intents(opts Options) gateway.Intents {
+	i := gateway.IntentGuilds |
+		gateway.IntentGuildMembers |
+		gateway.IntentGuildModeration |
+		gateway.IntentGuildEmojis |
+		gateway.IntentGuildIntegrations |
+		gateway.IntentGuildWebhooks |
+		gateway.IntentGuildInvites |
+		gateway.IntentGuildVoiceStates |
+		gateway.IntentGuildMessages |
+		gateway.IntentGuildMessageReactions |
+		gateway.IntentMessageContent |
+		gateway.IntentGuildScheduledEvents
+	if opts.Typing {
+		i |= gateway.IntentGuildMessageTyping
+	}
+	if opts.Presence {
+		i |= gateway.IntentGuildPresences
+	}
+	if opts.DMs {
+		i |= gateway.IntentDirectMessages
+	}
+	return i
+}
+
 func main() {
-	wsutil.WSDebug = log.Println
-	var token = os.Getenv("TOKEN")
-	if token == "" {
-		log.Fatalln("No $TOKEN given.")
-	}
-	s, err := state.New(token)
-	logger := NewLogger(s, "dislog")
-	if err != nil {
-		log.Fatalln("Session failed:", err)
-	}
-	eventChan, _ := s.ChanFor(
-		func(ev interface{}) bool {
-			gid := infer.GuildID(ev)
-			/*
-				for _, g := range serversToLog {
-					if gid == g {
-						println("THIS IS DANGAN")
-						return true
-					}
-				}
-			*/
-			if gid.IsValid() {
-				return true
+	if len(os.Args) > 1 {
+		var cmd func([]string) error
+		switch os.Args[1] {
+		case "dump":
+			cmd = dump
+		case "convert":
+			cmd = convert
+		case "decode":
+			cmd = decode
+		case "verify":
+			cmd = verify
+		}
+		if cmd != nil {
+			if err := cmd(os.Args[2:]); err != nil {
+				log.Fatalln(err)
 			}
-			return false
-		})
+			return
+		}
+	}
+	var opts Options
+	configFile := flag.String("config", "", "read settings from this TOML file, which is reloaded on SIGHUP")
+	printConfig := flag.Bool("print-default-config", false,
+		"print a config file with the default settings and exit")
+	dir := flag.String("path", "dislog", "directory to write logs to, relative to the working directory")
+	token := flag.String("token", "", "the bot's token (default $TOKEN)")
+	tokenFile := flag.String("token-file", "",
+		"read the bot's token from this file, e.g. a mounted secret, instead of -token (default $TOKEN_FILE)")
+	flag.Var(&opts.Filters.Categories, "log",
+		"comma-separated categories of entries to log: messages, reactions, members, moderation, voice, channels, roles, guild, events, interactions, typing and presence (default all)")
+	flag.BoolVar(&opts.Filters.Redact, "redact-content", false, "leave out the content of messages")
+	flag.BoolVar(&opts.Filters.IgnoreBots, "ignore-bots", false, "don't log the messages, reactions and typing of bots")
+	flag.BoolVar(&opts.Filters.IgnoreWebhooks, "ignore-webhooks", false, "don't log messages sent by webhooks")
+	flag.Var(&opts.Filters.IgnoreUsers, "ignore-users",
+		"comma-separated IDs of users whose messages, reactions and typing aren't logged")
+	flag.Var(&opts.Filters.Guilds.include, "guilds", "comma-separated IDs of the guilds to log (default all)")
+	flag.Var(&opts.Filters.Guilds.exclude, "exclude-guilds",
+		"comma-separated IDs of guilds not to log, which takes precedence over -guilds")
+	flag.Var(&opts.Filters.Entries, "entries", "comma-separated types of entries to log, e.g. msg,editmsg,delmsg (default all)")
+	flag.BoolVar(&opts.Typing, "typing", false, "log typing indicators")
+	flag.BoolVar(&opts.Presence, "presence", false,
+		"log presence updates (requires the presence intent)")
+	flag.BoolVar(&opts.PresenceTransitions, "presence-transitions", false,
+		"only log presence updates that change the user's status")
+	flag.BoolVar(&opts.Enrich, "enrich", false,
+		"fetch extra details for some entries over REST")
+	flag.BoolVar(&opts.DMs, "log-dms", false,
+		"log direct messages to the bot, to dm/<channel>.ndjson next to the guilds' files")
+	flag.BoolVar(&opts.Components, "components", false,
+		"log button clicks and select menu choices")
+	flag.BoolVar(&opts.AuthorMember, "author-member", false,
+		"record the nickname and roles of message authors")
+	flag.Var(&opts.Rotation, "rotation", "how often to rotate log files (daily, weekly or monthly)")
+	flag.Var(&opts.Layout, "layout", "how to split log files (guild, channel or combined)")
+	flag.Var(&opts.PathTemplate, "path-template",
+		"template for log file names, e.g. {guild}/{year}/{week}.ndjson (overrides -rotation and -layout)")
+	flag.Var(&opts.Format, "format", "how to encode log files (ndjson, protobuf or msgpack)")
+	flag.Var(&opts.Compress, "compress", "how to compress log files (none, gzip or zstd)")
+	flag.Var(&opts.Durability, "sync",
+		"when to sync log files to disk (rotate, entry, or an interval like 5s)")
+	retention := flag.Int("retention-days", 0,
+		"remove log files this many days after they were last written to (0 to keep them)")
+	flag.BoolVar(&opts.RetentionDryRun, "retention-dry-run", false,
+		"only list the log files that -retention-days would remove")
+	s3Endpoint := flag.String("s3-endpoint", "https://s3.amazonaws.com",
+		"endpoint of the S3-compatible service to upload log files to")
+	s3Bucket := flag.String("s3-bucket", "",
+		"upload rotated log files to this bucket, with the credentials in $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	gcsBucket := flag.String("gcs-bucket", "",
+		"upload rotated log files to this Google Cloud Storage bucket, with the application default credentials")
+	flag.BoolVar(&opts.DeleteArchived, "delete-archived", false,
+		"remove log files once they were uploaded")
+	rotationTZ := flag.String("rotation-tz", "UTC",
+		"time zone that log files are rotated in, e.g. Local or Europe/Berlin")
+	noLock := flag.Bool("no-lock", false,
+		"don't lock the log directory against other instances, e.g. on network filesystems")
+	var storeKind StoreKind
+	flag.Var(&storeKind, "store", "where to write entries (file, sqlite, postgres or bolt)")
+	dsn := flag.String("dsn", "",
+		"PostgreSQL connection string, for -store=postgres (default $DATABASE_URL)")
+	opts.DirMode, opts.FileMode = defaultDirMode, defaultFileMode
+	flag.Var((*Mode)(&opts.DirMode), "dir-mode",
+		"permissions of the directories that are created, in octal (existing ones are left alone)")
+	flag.Var((*Mode)(&opts.FileMode), "file-mode",
+		"permissions of the files that are created, in octal (existing ones are left alone)")
+	guildNames := flag.Bool("guild-names", false,
+		"add the guild's name to its ID in the names of log files, e.g. 1234-my-server.ndjson")
+	flag.IntVar(&opts.Writers, "writers", defaultWriters, "how many goroutines write entries to the store")
+	flag.IntVar(&opts.QueueSize, "queue-size", defaultQueueSize,
+		"how many entries each writer queues before logging waits for it")
+	flag.BoolVar(&opts.DropWhenFull, "drop-when-full", false,
+		"drop entries when a writer's queue is full instead of waiting, and count them")
+	flag.IntVar(&opts.WriteRetries, "write-retries", defaultWriteRetries,
+		"how many times to retry writing an entry, e.g. when the disk is full")
+	flag.Var(&opts.OnWriteFailure, "on-write-failure",
+		"what to do when an entry still can't be written after retrying it: hold it and the entries after it in memory until writing works again, or crash")
+	eventQueueSize := flag.Int("event-queue", defaultEventQueueSize,
+		"how many events to queue while they wait to be logged; events beyond that are dropped and counted")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 5*time.Second,
+		"how long to keep logging the queued events when shutting down; the ones left after that are dropped")
+	flag.IntVar(&opts.MaxOpenFiles, "max-open-files", defaultMaxOpenFiles,
+		"how many log files to keep open; the least recently written one is closed to make room")
+	maxSize := flag.Int64("max-size", 0,
+		"continue log files in a new file after this many MiB (0 for no limit)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: dislog [flags]\n       dislog dump|convert|decode|verify [args]\n\nflags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *printConfig {
+		if err := WriteDefaultConfig(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Fatalln("Invalid configuration:", err)
+	}
+	opts.Filters.Overrides = cfg.overrides(opts.Filters)
+	for id := range cfg.Guilds {
+		if !opts.Filters.Guilds.allows(id) {
+			log.Printf("Guild %s has settings in the config file, but isn't logged.", id)
+		}
+	}
+	opts.MaxSize = *maxSize << 20
+	opts.Retention = time.Duration(*retention) * 24 * time.Hour
+	opts.GuildRetention = cfg.retention()
+	loc, err := time.LoadLocation(*rotationTZ)
+	if err != nil {
+		log.Fatalln("Invalid -rotation-tz:", err)
+	}
+	opts.RotationZone = loc
+	switch {
+	case *s3Bucket != "" && *gcsBucket != "":
+		log.Fatalln("Only one of -s3-bucket and -gcs-bucket can be given.")
+	case *s3Bucket != "":
+		opts.Archive, err = newS3Archive(*s3Endpoint, *s3Bucket)
+		if err != nil {
+			log.Fatalln("Failed to set up S3:", err)
+		}
+	case *gcsBucket != "":
+		opts.Archive, err = newGCSArchive(*gcsBucket)
+		if err != nil {
+			log.Fatalln("Failed to set up Google Cloud Storage:", err)
+		}
+	}
+	if *eventQueueSize < 1 {
+		log.Fatalln("-event-queue must be at least 1.")
+	}
+	if err := checkModes(opts.DirMode, opts.FileMode); err != nil {
+		log.Fatalln("Invalid -dir-mode or -file-mode:", err)
+	}
+	if opts.PathTemplate != "" && !opts.PathTemplate.has("{guild}") && opts.Layout != LayoutCombined {
+		log.Fatalln("The path template is missing {guild}, which is only allowed with -layout=combined.")
+	}
+	*dir, err = filepath.Abs(*dir)
+	if err == nil {
+		err = os.MkdirAll(*dir, opts.DirMode)
+	}
+	if err != nil {
+		log.Fatalln("Failed to create the log directory:", err)
+	}
 
-	if err := s.Open(); err != nil {
+	ws.WSDebug = log.Println
+	if *tokenFile != "" {
+		if *token != "" {
+			log.Println("Both a token and a token file were given, using the token file.")
+		}
+		b, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatalln("Failed to read the token file:", err)
+		}
+		*token = strings.TrimRight(string(b), " \t\r\n")
+		if *token == "" {
+			log.Fatalf("The token file %s is empty.", *tokenFile)
+		}
+	}
+	if *token == "" {
+		log.Fatalln("No -token, $TOKEN or -token-file given.")
+	}
+	s := state.New("Bot " + *token)
+	s.AddIntents(intents(opts))
+	if *guildNames {
+		opts.GuildName = func(id discord.GuildID) string {
+			g, err := s.Cabinet.Guild(id)
+			if err != nil {
+				return ""
+			}
+			return g.Name
+		}
+	}
+	unlock := func() {}
+	if !*noLock {
+		unlock, err = lockDir(*dir, opts.DirMode, opts.FileMode)
+		if err != nil {
+			log.Fatalln("Failed to lock the log directory:", err)
+		}
+	}
+	opts.DeadLetters, err = newDeadLetters(*dir, opts.DirMode, opts.FileMode)
+	if err != nil {
+		log.Fatalln("Failed to set up the dead letter file:", err)
+	}
+	opts.Sequences, err = loadSequences(*dir, opts.FileMode)
+	if err != nil {
+		log.Fatalln("Failed to load the sequence numbers:", err)
+	}
+	store, err := openStore(storeKind, *dir, *dsn, opts)
+	if err != nil {
+		log.Fatalln("Failed to open store:", err)
+	}
+	logger := NewLogger(s, store, opts)
+	shouldLog := logger.LogsEvent
+	s.PreHandler = handler.New()
+	s.PreHandler.AddSyncHandler(func(ev interface{}) {
+		if shouldLog(ev) {
+			logger.Snapshot(ev)
+		}
+	})
+	// Events are queued by a sync handler, so that they stay in order,
+	// and dropped if the queue is full, so that the gateway isn't held
+	// up. The snapshots of dropped events are forgotten.
+	events := newEventQueue(*eventQueueSize, logger.Forget)
+	removeHandler := s.AddSyncHandler(func(ev interface{}) {
+		if shouldLog(ev) {
+			events.push(ev)
+		}
+	})
+	dropReport := time.NewTicker(droppedReportInterval)
+
+	if err := s.Open(context.Background()); err != nil {
 		log.Fatalln("Failed to connect:", err)
 	}
-	defer s.Close()
 
+	// reload applies the changes to the config file that can be made
+	// without reconnecting.
+	reload := func() {
+		cfg, err = reloadConfig(cfg)
+		if err != nil {
+			log.Println("Failed to reload the config file, keeping the old one:", err)
+			return
+		}
+		opts.Filters.Overrides = cfg.overrides(opts.Filters)
+		logger.SetFilters(opts.Filters)
+		opts.Retention = time.Duration(*retention) * 24 * time.Hour
+		opts.GuildRetention = cfg.retention()
+		if r, ok := store.(retentionSetter); ok {
+			r.SetRetention(opts.Retention, opts.GuildRetention, opts.RetentionDryRun)
+		}
+		log.Println("Reloaded the config file.")
+	}
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+loop:
 	for {
 		select {
-		case e := <-eventChan:
+		case e := <-events.events:
 			logger.HandleEvent(e)
+		case <-dropReport.C:
+			logger.LogDropped(events.takeDropped())
+		case <-hup:
+			logger.Reopen()
+			if *configFile != "" {
+				reload()
+			}
 		case <-sigs:
-			logger.Close()
-			os.Exit(0)
+			break loop
 		}
 	}
+
+	// Shut down in order: stop taking events, log the ones that are
+	// still queued, write out and close the log files, and only then
+	// disconnect.
+	// Another signal cuts it short.
+	go func() {
+		<-sigs
+		log.Println("Exiting without finishing the shutdown.")
+		os.Exit(1)
+	}()
+	log.Println("Shutting down, send the signal again to exit immediately.")
+	removeHandler()
+	dropReport.Stop()
+	events.drain(logger.HandleEvent, *shutdownTimeout)
+	logger.LogDropped(events.takeDropped())
+	logger.Close()
+	unlock()
+	if err := s.Close(); err != nil {
+		log.Println("error while disconnecting:", err)
+	}
 }
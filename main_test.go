@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+// memStore keeps the records appended to it.
+type memStore struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (s *memStore) Append(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memStore) Close() error { return nil }
+
+// entries returns the entries of the given type, in the order they were
+// written.
+func (s *memStore) entries(typ EntryType) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []Entry
+	for _, r := range s.records {
+		if r.Entry.Type == typ {
+			entries = append(entries, r.Entry)
+		}
+	}
+	return entries
+}
+
+// testChannel is the channel that the test events are in. Its name is cached,
+// so that no REST calls are made for it.
+const testChannel discord.ChannelID = 100
+
+// newTestLogger returns a Logger that writes to a memStore, with a state that
+// has no connection. The entries are all written once it's closed.
+func newTestLogger(t *testing.T, opts Options) (*Logger, *memStore) {
+	t.Helper()
+	st := &memStore{}
+	l := NewLogger(state.New("Bot test"), st, opts)
+	l.channels.set(testChannel, "general")
+	return l, st
+}
+
+func testMessage(gid discord.GuildID, id discord.MessageID) *gateway.MessageCreateEvent {
+	return &gateway.MessageCreateEvent{Message: discord.Message{
+		ID:        id,
+		GuildID:   gid,
+		ChannelID: testChannel,
+		Author:    discord.User{ID: 1, Username: "user"},
+		Content:   "hello",
+	}}
+}
+
+func TestEntriesHaveVersion(t *testing.T) {
+	l, st := newTestLogger(t, Options{})
+	l.HandleEvent(testMessage(1, 10))
+	l.Close()
+	entries := st.entries(EntryMessage)
+	if len(entries) != 1 {
+		t.Fatalf("got %d msg entries, want 1", len(entries))
+	}
+	if v := entries[0].Version; v != EntryVersion {
+		t.Errorf("entry has version %d, want %d", v, EntryVersion)
+	}
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf(`{"v":%d,`, EntryVersion); !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("entry is written as %s, want it to start with %s", buf.String(), want)
+	}
+}
+
+func TestMissingVersionIsZero(t *testing.T) {
+	in := `{"type":"msg","time":"2024-06-03T12:00:00.000Z","data":{}}` + "\n"
+	var e Entry
+	if err := FormatJSON.decoder(strings.NewReader(in))(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != 0 {
+		t.Errorf("entry without v has version %d, want 0", e.Version)
+	}
+}
+
+func TestNormalizeChannelID(t *testing.T) {
+	tests := []struct {
+		version int
+		data    string
+		want    string
+	}{
+		{1, `{"author":"5","name":"general"}`, `{"id":"5","name":"general"}`},
+		{2, `{"id":"5","name":"general"}`, `{"id":"5","name":"general"}`},
+	}
+	for _, test := range tests {
+		e := Entry{Version: test.version, Type: EntryChannel, Data: json.RawMessage(test.data)}
+		normalize(&e)
+		if string(e.Data) != test.want {
+			t.Errorf("version %d: normalized %s to %s, want %s", test.version, test.data, e.Data, test.want)
+		}
+		if e.Version != test.version {
+			t.Errorf("version %d: normalize changed the version to %d", test.version, e.Version)
+		}
+	}
+}
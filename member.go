@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logGuildMemberAddEvent(m *gateway.GuildMemberAddEvent) {
+	l.trackTag(m.GuildID, m.User)
+	entry := MemberEntry{
+		User:    toUser(m.User),
+		Joined:  m.Joined,
+		Created: m.User.ID.Time().UTC(),
+		Bot:     m.User.Bot,
+	}
+	err := l.appendEntry(m.GuildID, EntryMemberJoin, entry)
+	if err != nil {
+		log.Println("error while logging GuildMemberAddEvent:", err)
+	}
+}
+
+// The remove event is sent for kicks and bans as well as voluntary leaves, so
+// the entry only records that the member is gone.
+func (l *Logger) logGuildMemberRemoveEvent(m *gateway.GuildMemberRemoveEvent) {
+	entry := MemberLeaveEntry{
+		User: toUser(m.User),
+	}
+	err := l.appendEntry(m.GuildID, EntryMemberLeave, entry)
+	if err != nil {
+		log.Println("error while logging GuildMemberRemoveEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildMemberUpdateEvent(m *gateway.GuildMemberUpdateEvent) {
+	l.trackTag(m.GuildID, m.User)
+	entry := MemberUpdateEntry{
+		User:  toUser(m.User),
+		Nick:  m.Nick,
+		Roles: m.RoleIDs,
+	}
+	if prev, ok := l.previous(m).(*discord.Member); ok {
+		entry.OldNick = &prev.Nick
+		entry.AddedRoles, entry.RemovedRoles = diffRoles(prev.RoleIDs, m.RoleIDs)
+		l.logMemberBoost(m.GuildID, entry.User, entry.AddedRoles, entry.RemovedRoles)
+		if prev.Nick == m.Nick &&
+			len(entry.AddedRoles) == 0 && len(entry.RemovedRoles) == 0 {
+			return
+		}
+	}
+	err := l.appendEntry(m.GuildID, EntryMemberUpdate, entry)
+	if err != nil {
+		log.Println("error while logging GuildMemberUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildBanAddEvent(b *gateway.GuildBanAddEvent) {
+	err := l.appendEntry(b.GuildID, EntryBan, BanEntry{User: toUser(b.User)})
+	if err != nil {
+		log.Println("error while logging GuildBanAddEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildBanRemoveEvent(b *gateway.GuildBanRemoveEvent) {
+	err := l.appendEntry(b.GuildID, EntryUnban, BanEntry{User: toUser(b.User)})
+	if err != nil {
+		log.Println("error while logging GuildBanRemoveEvent:", err)
+	}
+}
+
+// diffRoles returns the roles that are in new but not in old, and the roles
+// that are in old but not in new.
+func diffRoles(old, new []discord.RoleID) (added, removed []discord.RoleID) {
+	set := make(map[discord.RoleID]bool, len(old))
+	for _, id := range old {
+		set[id] = true
+	}
+	for _, id := range new {
+		if set[id] {
+			delete(set, id)
+		} else {
+			added = append(added, id)
+		}
+	}
+	for _, id := range old {
+		if set[id] {
+			removed = append(removed, id)
+		}
+	}
+	return
+}
+
+// MemberEntry is written when a member joins a guild. Created is the creation
+// time of the account, derived from its ID.
+type MemberEntry struct {
+	User    User              `json:"user"`
+	Joined  discord.Timestamp `json:"joined"`
+	Created time.Time         `json:"created"`
+	Bot     bool              `json:"bot"`
+}
+
+type MemberLeaveEntry struct {
+	User User `json:"user"`
+}
+
+// MemberUpdateEntry always contains the member's new nickname and roles. If
+// the member's previous state was cached, OldNick is set and the roles that
+// were added and removed are listed.
+type MemberUpdateEntry struct {
+	User         User             `json:"user"`
+	Nick         string           `json:"nick"`
+	Roles        []discord.RoleID `json:"roles"`
+	OldNick      *string          `json:"oldNick,omitempty"`
+	AddedRoles   []discord.RoleID `json:"addedRoles,omitempty"`
+	RemovedRoles []discord.RoleID `json:"removedRoles,omitempty"`
+}
+
+// BanEntry is written both when a user is banned and when they are unbanned.
+type BanEntry struct {
+	User User `json:"user"`
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func toAttachments(attachments []discord.Attachment) []Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	a := make([]Attachment, len(attachments))
+	for i, at := range attachments {
+		a[i] = Attachment{
+			ID:          at.ID,
+			Filename:    at.Filename,
+			Size:        at.Size,
+			ContentType: at.ContentType,
+			URL:         at.URL,
+		}
+	}
+	return a
+}
+
+// Attachment is a file attached to a message. URL points to Discord's CDN,
+// and stops working some time after the message was sent.
+type Attachment struct {
+	ID          discord.AttachmentID `json:"id"`
+	Filename    string               `json:"filename"`
+	Size        uint64               `json:"size"`
+	ContentType string               `json:"contentType,omitempty"`
+	URL         discord.URL          `json:"url"`
+}
+
+func toEmbeds(embeds []discord.Embed) []Embed {
+	if len(embeds) == 0 {
+		return nil
+	}
+	e := make([]Embed, len(embeds))
+	for i, em := range embeds {
+		e[i] = Embed{
+			Title:       em.Title,
+			Description: em.Description,
+			URL:         em.URL,
+		}
+		if em.Footer != nil {
+			e[i].Footer = em.Footer.Text
+		}
+		if len(em.Fields) > 0 {
+			e[i].Fields = make([]EmbedField, len(em.Fields))
+			for j, f := range em.Fields {
+				e[i].Fields[j] = EmbedField{f.Name, f.Value}
+			}
+		}
+	}
+	return e
+}
+
+// Embed is a trimmed down embed, keeping only its text.
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	Description string       `json:"description,omitempty"`
+	URL         discord.URL  `json:"url,omitempty"`
+	Fields      []EmbedField `json:"fields,omitempty"`
+	Footer      string       `json:"footer,omitempty"`
+}
+
+type EmbedField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func toStickers(stickers []discord.StickerItem) []Sticker {
+	if len(stickers) == 0 {
+		return nil
+	}
+	s := make([]Sticker, len(stickers))
+	for i, st := range stickers {
+		s[i] = Sticker{
+			ID:     st.ID,
+			Name:   st.Name,
+			Format: stickerFormatName(st.FormatType),
+			URL:    stickerURL(st),
+		}
+	}
+	return s
+}
+
+// stickerFormatGIF is missing from arikawa.
+const stickerFormatGIF discord.StickerFormatType = 4
+
+func stickerFormatName(f discord.StickerFormatType) string {
+	switch f {
+	case discord.StickerFormatPNG:
+		return "png"
+	case discord.StickerFormatAPNG:
+		return "apng"
+	case discord.StickerFormatLottie:
+		return "lottie"
+	case stickerFormatGIF:
+		return "gif"
+	default:
+		return strconv.Itoa(int(f))
+	}
+}
+
+// stickerURL returns the URL of the sticker's asset. APNG stickers are
+// served as .png, and Lottie stickers as JSON.
+func stickerURL(st discord.StickerItem) string {
+	ext := ".png"
+	switch st.FormatType {
+	case discord.StickerFormatLottie:
+		ext = ".json"
+	case stickerFormatGIF:
+		ext = ".gif"
+	}
+	return "https://cdn.discordapp.com/stickers/" + st.ID.String() + ext
+}
+
+type Sticker struct {
+	ID     discord.StickerID `json:"id"`
+	Name   string            `json:"name"`
+	Format string            `json:"format"`
+	URL    string            `json:"url"`
+}
+
+// replyTo returns what the message replies to, or nil if it isn't a reply.
+// The author is taken from the referenced message if Discord sent it along,
+// or from the cache otherwise.
+func (l *Logger) replyTo(m discord.Message) *Reply {
+	if m.Type != discord.InlinedReplyMessage || m.Reference == nil {
+		return nil
+	}
+	reply := &Reply{
+		ID:      m.Reference.MessageID,
+		Channel: m.Reference.ChannelID,
+	}
+	// The referenced message may be in another channel or guild, in which
+	// case it's most likely not cached.
+	ref := m.ReferencedMessage
+	if ref == nil && reply.ID.IsValid() && reply.Channel.IsValid() {
+		ref, _ = l.s.Cabinet.Message(reply.Channel, reply.ID)
+	}
+	if ref != nil {
+		author := toUser(ref.Author)
+		reply.Author = &author
+	}
+	return reply
+}
+
+// Reply is the message a message replies to. Author is only set if the
+// message was sent along with the reply or cached.
+type Reply struct {
+	ID      discord.MessageID `json:"id"`
+	Channel discord.ChannelID `json:"channel"`
+	Author  *User             `json:"author,omitempty"`
+}
+
+// mentions returns who the message mentions, or nil if it mentions no one.
+func (l *Logger) mentions(m discord.Message) *Mentions {
+	if len(m.Mentions) == 0 && len(m.MentionRoleIDs) == 0 && !m.MentionEveryone {
+		return nil
+	}
+	mentions := &Mentions{Everyone: m.MentionEveryone}
+	for _, u := range m.Mentions {
+		mentions.Users = append(mentions.Users, toUser(u.User))
+	}
+	for _, id := range m.MentionRoleIDs {
+		role := MentionedRole{ID: id}
+		if r, err := l.s.Cabinet.Role(m.GuildID, id); err == nil {
+			role.Name = r.Name
+		}
+		mentions.Roles = append(mentions.Roles, role)
+	}
+	return mentions
+}
+
+// Mentions are the users and roles a message mentions. Everyone is set for
+// both @everyone and @here.
+type Mentions struct {
+	Users    []User          `json:"users,omitempty"`
+	Roles    []MentionedRole `json:"roles,omitempty"`
+	Everyone bool            `json:"everyone,omitempty"`
+}
+
+// MentionedRole is a role mentioned in a message. Name is only set if the
+// role is cached.
+type MentionedRole struct {
+	ID   discord.RoleID `json:"id"`
+	Name string         `json:"name,omitempty"`
+}
+
+// authorMember returns the author's nickname and roles at the time the
+// message was sent, falling back to the cache if the event didn't carry them.
+func (l *Logger) authorMember(m *gateway.MessageCreateEvent) *AuthorMember {
+	member := m.Member
+	if member == nil {
+		var err error
+		member, err = l.s.Cabinet.Member(m.GuildID, m.Author.ID)
+		if err != nil {
+			return nil
+		}
+	}
+	return &AuthorMember{
+		Nick:  member.Nick,
+		Roles: member.RoleIDs,
+	}
+}
+
+type AuthorMember struct {
+	Nick  string           `json:"nick,omitempty"`
+	Roles []discord.RoleID `json:"roles,omitempty"`
+}
+
+// toComponents returns the message's action rows, each as the list of
+// components in it.
+func toComponents(components discord.ContainerComponents) [][]Component {
+	var rows [][]Component
+	for _, c := range components {
+		row, ok := c.(*discord.ActionRowComponent)
+		if !ok {
+			continue
+		}
+		r := make([]Component, len(*row))
+		for i, ic := range *row {
+			r[i] = toComponent(ic)
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func toComponent(ic discord.InteractiveComponent) Component {
+	c := Component{
+		Type:     componentTypeName(ic.Type()),
+		CustomID: ic.ID(),
+	}
+	switch ic := ic.(type) {
+	case *discord.ButtonComponent:
+		c.Label = ic.Label
+		c.Style = buttonStyleName(ic.Style)
+		c.Disabled = ic.Disabled
+	case *discord.StringSelectComponent:
+		c.Placeholder = ic.Placeholder
+		c.Disabled = ic.Disabled
+		c.Options = make([]SelectOption, len(ic.Options))
+		for i, opt := range ic.Options {
+			c.Options[i] = SelectOption{opt.Label, opt.Value}
+		}
+	case *discord.UserSelectComponent:
+		c.Placeholder = ic.Placeholder
+		c.Disabled = ic.Disabled
+	case *discord.RoleSelectComponent:
+		c.Placeholder = ic.Placeholder
+		c.Disabled = ic.Disabled
+	case *discord.MentionableSelectComponent:
+		c.Placeholder = ic.Placeholder
+		c.Disabled = ic.Disabled
+	case *discord.ChannelSelectComponent:
+		c.Placeholder = ic.Placeholder
+		c.Disabled = ic.Disabled
+	}
+	return c
+}
+
+func componentTypeName(t discord.ComponentType) string {
+	switch t {
+	case discord.ButtonComponentType:
+		return "button"
+	case discord.StringSelectComponentType:
+		return "select"
+	case discord.TextInputComponentType:
+		return "textinput"
+	case discord.UserSelectComponentType:
+		return "userselect"
+	case discord.RoleSelectComponentType:
+		return "roleselect"
+	case discord.MentionableSelectComponentType:
+		return "mentionableselect"
+	case discord.ChannelSelectComponentType:
+		return "channelselect"
+	default:
+		return strconv.Itoa(int(t))
+	}
+}
+
+// buttonStyleName can't switch on the style's type, which arikawa keeps
+// unexported, so it compares against the exported styles instead. Anything
+// else is a link button.
+func buttonStyleName(s discord.ButtonComponentStyle) string {
+	switch s {
+	case discord.PrimaryButtonStyle():
+		return "primary"
+	case discord.SecondaryButtonStyle():
+		return "secondary"
+	case discord.SuccessButtonStyle():
+		return "success"
+	case discord.DangerButtonStyle():
+		return "danger"
+	default:
+		return "link"
+	}
+}
+
+// Component is a trimmed down message component. Label and Style are only set
+// for buttons, and Placeholder and Options for select menus.
+type Component struct {
+	Type        string              `json:"type"`
+	CustomID    discord.ComponentID `json:"customID,omitempty"`
+	Label       string              `json:"label,omitempty"`
+	Style       string              `json:"style,omitempty"`
+	Placeholder string              `json:"placeholder,omitempty"`
+	Options     []SelectOption      `json:"options,omitempty"`
+	Disabled    bool                `json:"disabled,omitempty"`
+}
+
+type SelectOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+func toCachedMessage(m discord.Message) CachedMessage {
+	return CachedMessage{
+		ID:        m.ID,
+		Author:    toUser(m.Author),
+		Content:   m.Content,
+		Timestamp: m.Timestamp,
+	}
+}
+
+// optionalTimestamp returns nil for timestamps that aren't set, so that they
+// are left out of entries rather than written as null.
+func optionalTimestamp(t discord.Timestamp) *discord.Timestamp {
+	if !t.IsValid() {
+		return nil
+	}
+	return &t
+}
+
+// CachedMessage is a message recovered from the state cache.
+type CachedMessage struct {
+	ID        discord.MessageID `json:"id"`
+	Author    User              `json:"author"`
+	Content   string            `json:"content"`
+	Redacted  bool              `json:"redacted,omitempty"`
+	Timestamp discord.Timestamp `json:"time"`
+}
+
+// systemMessage describes system messages, e.g. join notifications, which
+// usually have no content of their own. It returns an empty string for
+// messages sent by users.
+func systemMessage(m discord.Message) string {
+	name := toUser(m.Author).Tag
+	switch m.Type {
+	case discord.GuildMemberJoinMessage:
+		return name + " joined the server"
+	case discord.NitroBoostMessage:
+		return name + " boosted the server"
+	case discord.NitroTier1Message:
+		return name + " boosted the server, which reached level 1"
+	case discord.NitroTier2Message:
+		return name + " boosted the server, which reached level 2"
+	case discord.NitroTier3Message:
+		return name + " boosted the server, which reached level 3"
+	case discord.ChannelPinnedMessage:
+		return name + " pinned a message"
+	case discord.ChannelNameChangeMessage:
+		return name + " changed the channel name to " + m.Content
+	case discord.ChannelIconChangeMessage:
+		return name + " changed the channel icon"
+	case discord.ChannelFollowAddMessage:
+		return name + " added " + m.Content + " to this channel's followers"
+	case discord.ThreadCreatedMessage:
+		return name + " started a thread: " + m.Content
+	case discord.StageStartMessage:
+		return name + " started the stage " + m.Content
+	case discord.StageEndMessage:
+		return name + " ended the stage " + m.Content
+	case discord.StageSpeakerMessage:
+		return name + " is now a speaker"
+	case discord.StageTopicMessage:
+		return name + " changed the stage topic to " + m.Content
+	case discord.AutoModerationActionMessage:
+		return "AutoMod took action against a message by " + name
+	default:
+		return ""
+	}
+}
+
+// hasFlag returns whether flag is set. Flags that were null have none set.
+func hasFlag(flags, flag discord.MessageFlags) bool {
+	return flags != discord.NullMessage && flags&flag != 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// defaultDirMode and defaultFileMode are the permissions that
+	// directories and files are created with by default, which only let
+	// the user dislog runs as in.
+	defaultDirMode  os.FileMode = 0700
+	defaultFileMode os.FileMode = 0600
+)
+
+// Mode is the permission bits of files or directories, as an octal number
+// such as 0750. It's a flag.Value for an os.FileMode.
+type Mode os.FileMode
+
+// String implements flag.Value.
+func (m Mode) String() string {
+	return fmt.Sprintf("%#o", uint32(m))
+}
+
+// Set implements flag.Value.
+func (m *Mode) Set(s string) error {
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v&^0777 != 0 {
+		return fmt.Errorf("invalid mode %q, expected permission bits in octal such as 0750", s)
+	}
+	*m = Mode(v)
+	return nil
+}
+
+// checkModes returns an error if the modes would keep dislog from using the
+// files and directories it creates.
+func checkModes(dirMode, fileMode os.FileMode) error {
+	if dirMode&0700 != 0700 {
+		return fmt.Errorf("directory mode %#o must give the owner read, write and execute permission", uint32(dirMode))
+	}
+	if fileMode&0600 != 0600 {
+		return fmt.Errorf("file mode %#o must give the owner read and write permission", uint32(fileMode))
+	}
+	return nil
+}
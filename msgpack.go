@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// The entries in .msgpack files are the same as in .ndjson files, but
+// encoded as MessagePack instead of JSON, and each prefixed with its length
+// as a varint. The entries are converted from and to JSON, so that the field
+// names and the order of the fields stay the same.
+
+func encodeMsgpack(buf *bytes.Buffer, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg, err := jsonToMsgpack(b)
+	if err != nil {
+		return err
+	}
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(msg)))])
+	buf.Write(msg)
+	return nil
+}
+
+// decodeMsgpack decodes an entry without its length prefix.
+func decodeMsgpack(msg []byte, e *Entry) error {
+	b, err := msgpackToJSON(msg)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, e); err != nil {
+		return err
+	}
+	// Entries written before their times were in UTC have an offset.
+	e.Time = e.Time.UTC()
+	return nil
+}
+
+// jsonMember is a member of a JSON object. Objects are kept as lists of
+// members, so that their order is kept.
+type jsonMember struct {
+	Name  string
+	Value interface{}
+}
+
+// jsonToMsgpack converts a JSON value to MessagePack. Numbers are encoded as
+// integers if they are whole, and as floats otherwise.
+func jsonToMsgpack(b []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	v, err := parseJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgpack(nil, v)
+}
+
+func parseJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		var obj []jsonMember
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := parseJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{name.(string), v})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := parseJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+func appendMsgpack(b []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		if v {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendMsgpackInt(b, i), nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			b = append(b, 0xcf)
+			return binary.BigEndian.AppendUint64(b, u), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, 0xcb)
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+	case string:
+		b = appendMsgpackHeader(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b = append(b, v...)
+	case []interface{}:
+		b = appendMsgpackHeader(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, elem := range v {
+			if b, err = appendMsgpack(b, elem); err != nil {
+				return nil, err
+			}
+		}
+	case []jsonMember:
+		b = appendMsgpackHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, m := range v {
+			b, _ = appendMsgpack(b, m.Name)
+			if b, err = appendMsgpack(b, m.Value); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected JSON value %v", v)
+	}
+	return b, nil
+}
+
+func appendMsgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(i))
+	}
+}
+
+// appendMsgpackHeader appends the header of a string, array or map of n
+// elements. fix is the type byte of the short form, which fits n below
+// fixMax, and t8, t16 and t32 are the type bytes of the forms with 8, 16 and
+// 32 bit lengths. Arrays and maps have no 8 bit form, which is passed as 0.
+func appendMsgpackHeader(b []byte, n int, fix byte, fixMax int, t8, t16, t32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case t8 != 0 && n <= math.MaxUint8:
+		return append(b, t8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, t16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, t32), uint32(n))
+	}
+}
+
+var errMsgpackShort = errors.New("truncated MessagePack value")
+
+// msgpackToJSON converts a MessagePack value to JSON. Only the types that
+// jsonToMsgpack produces, and float32, are supported.
+func msgpackToJSON(b []byte) ([]byte, error) {
+	var out bytes.Buffer
+	rest, err := writeMsgpackJSON(&out, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data after MessagePack value")
+	}
+	return out.Bytes(), nil
+}
+
+func writeMsgpackJSON(out *bytes.Buffer, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errMsgpackShort
+	}
+	t, b := b[0], b[1:]
+	// need returns the next n bytes of b.
+	need := func(n int) ([]byte, error) {
+		if len(b) < n {
+			return nil, errMsgpackShort
+		}
+		v := b[:n]
+		b = b[n:]
+		return v, nil
+	}
+	var n int
+	switch {
+	case t < 0x80:
+		out.WriteString(strconv.Itoa(int(t)))
+		return b, nil
+	case t >= 0xe0:
+		out.WriteString(strconv.Itoa(int(int8(t))))
+		return b, nil
+	case t&0xe0 == 0xa0:
+		return writeMsgpackString(out, b, int(t&0x1f))
+	case t&0xf0 == 0x90:
+		return writeMsgpackArray(out, b, int(t&0x0f))
+	case t&0xf0 == 0x80:
+		return writeMsgpackMap(out, b, int(t&0x0f))
+	}
+	switch t {
+	case 0xc0:
+		out.WriteString("null")
+	case 0xc2:
+		out.WriteString("false")
+	case 0xc3:
+		out.WriteString("true")
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := need(1 << (t - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range v {
+			u = u<<8 | uint64(c)
+		}
+		out.WriteString(strconv.FormatUint(u, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		v, err := need(size)
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range v {
+			u = u<<8 | uint64(c)
+		}
+		// Sign-extend from the value's size.
+		shift := 64 - 8*size
+		out.WriteString(strconv.FormatInt(int64(u<<shift)>>shift, 10))
+	case 0xca:
+		v, err := need(4)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float32frombits(binary.BigEndian.Uint32(v))
+		out.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	case 0xcb:
+		v, err := need(8)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float64frombits(binary.BigEndian.Uint64(v))
+		out.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	case 0xd9, 0xda, 0xdb, 0xdc, 0xdd, 0xde, 0xdf:
+		var size int
+		switch t {
+		case 0xd9:
+			size = 1
+		case 0xda, 0xdc, 0xde:
+			size = 2
+		default:
+			size = 4
+		}
+		v, err := need(size)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range v {
+			n = n<<8 | int(c)
+		}
+		switch t {
+		case 0xd9, 0xda, 0xdb:
+			return writeMsgpackString(out, b, n)
+		case 0xdc, 0xdd:
+			return writeMsgpackArray(out, b, n)
+		default:
+			return writeMsgpackMap(out, b, n)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported MessagePack type 0x%x", t)
+	}
+	return b, nil
+}
+
+func writeMsgpackString(out *bytes.Buffer, b []byte, n int) ([]byte, error) {
+	if len(b) < n {
+		return nil, errMsgpackShort
+	}
+	s, _ := json.Marshal(string(b[:n]))
+	out.Write(s)
+	return b[n:], nil
+}
+
+func writeMsgpackArray(out *bytes.Buffer, b []byte, n int) ([]byte, error) {
+	var err error
+	out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if b, err = writeMsgpackJSON(out, b); err != nil {
+			return nil, err
+		}
+	}
+	out.WriteByte(']')
+	return b, nil
+}
+
+func writeMsgpackMap(out *bytes.Buffer, b []byte, n int) ([]byte, error) {
+	var err error
+	out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		// Keys are always strings in the maps that jsonToMsgpack
+		// produces.
+		if len(b) > 0 && b[0]&0xe0 != 0xa0 && b[0] != 0xd9 && b[0] != 0xda && b[0] != 0xdb {
+			return nil, errors.New("MessagePack map key isn't a string")
+		}
+		if b, err = writeMsgpackJSON(out, b); err != nil {
+			return nil, err
+		}
+		out.WriteByte(':')
+		if b, err = writeMsgpackJSON(out, b); err != nil {
+			return nil, err
+		}
+	}
+	out.WriteByte('}')
+	return b, nil
+}
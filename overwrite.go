@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// diffOverwrites returns how the channel's permission overwrites changed.
+func (l *Logger) diffOverwrites(gid discord.GuildID, old, new []discord.Overwrite) []OverwriteChange {
+	prev := make(map[discord.Snowflake]discord.Overwrite, len(old))
+	for _, o := range old {
+		prev[o.ID] = o
+	}
+	var changes []OverwriteChange
+	for _, o := range new {
+		p, ok := prev[o.ID]
+		delete(prev, o.ID)
+		if ok && p.Allow == o.Allow && p.Deny == o.Deny {
+			continue
+		}
+		change := l.toOverwriteChange(gid, o, ActionCreate)
+		if ok {
+			change.Action = ActionUpdate
+			change.OldAllow = &p.Allow
+			change.OldDeny = &p.Deny
+		}
+		changes = append(changes, change)
+	}
+	// Go over old again to keep the removed overwrites in order.
+	for _, o := range old {
+		if _, ok := prev[o.ID]; ok {
+			changes = append(changes, l.toOverwriteChange(gid, o, ActionDelete))
+		}
+	}
+	return changes
+}
+
+// toOverwriteChange resolves the name of the overwrite's role or member from
+// the cache, if possible.
+func (l *Logger) toOverwriteChange(gid discord.GuildID, o discord.Overwrite, action Action) OverwriteChange {
+	change := OverwriteChange{
+		Action: action,
+		ID:     o.ID,
+		Allow:  o.Allow,
+		Deny:   o.Deny,
+	}
+	switch o.Type {
+	case discord.OverwriteRole:
+		change.Type = "role"
+		if r, err := l.s.Cabinet.Role(gid, discord.RoleID(o.ID)); err == nil {
+			change.Name = r.Name
+		}
+	case discord.OverwriteMember:
+		change.Type = "member"
+		change.Name = l.userFromID(gid, discord.UserID(o.ID)).Tag
+	}
+	return change
+}
+
+// OverwriteChange is a permission overwrite that was added, changed, or
+// removed. For removed overwrites, Allow and Deny are what they were before.
+type OverwriteChange struct {
+	Action   Action               `json:"action"`
+	ID       discord.Snowflake    `json:"id"`
+	Type     string               `json:"type"`
+	Name     string               `json:"name,omitempty"`
+	Allow    discord.Permissions  `json:"allow"`
+	Deny     discord.Permissions  `json:"deny"`
+	OldAllow *discord.Permissions `json:"oldAllow,omitempty"`
+	OldDeny  *discord.Permissions `json:"oldDeny,omitempty"`
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	// postgresQueueSize is how many entries are buffered at most. Entries
+	// that don't fit are written to the fallback file instead.
+	postgresQueueSize = 10000
+	// postgresBatchSize is how many entries are inserted per transaction at
+	// most.
+	postgresBatchSize = 500
+	// postgresFlushInterval is how long entries are buffered at most before
+	// they're inserted.
+	postgresFlushInterval = time.Second
+	// postgresMaxBackoff bounds the time between reconnection attempts.
+	postgresMaxBackoff = time.Minute
+)
+
+// postgresSchema creates the entries table. v is the entry's EntryVersion.
+// The ID columns are NULL for entries they don't apply to, and so is seq for
+// entries without a sequence number. It's added to tables that were created
+// before it.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	id      bigserial PRIMARY KEY,
+	v       integer NOT NULL,
+	type    text NOT NULL,
+	time    timestamptz NOT NULL,
+	guild   bigint NOT NULL,
+	channel bigint,
+	message bigint,
+	author  bigint,
+	data    jsonb NOT NULL
+);
+ALTER TABLE entries ADD COLUMN IF NOT EXISTS seq bigint;
+CREATE INDEX IF NOT EXISTS entries_guild_time ON entries (guild, time);
+CREATE INDEX IF NOT EXISTS entries_message ON entries (message) WHERE message IS NOT NULL;
+`
+
+// postgresStore writes entries to a PostgreSQL database in batches. While
+// the database can't be reached, or if the queue is full, entries are
+// appended to a fallback file, which is inserted once the database is back
+// or the queue was emptied.
+type postgresStore struct {
+	db *sql.DB
+
+	queue chan Record
+	// done is closed when the store is closed, and closed is closed once
+	// the queue was emptied after that.
+	done   chan struct{}
+	closed chan struct{}
+
+	// fallback is the name of the fallback file, which holds Records as
+	// JSON, one per line. It's created with fileMode.
+	fallback   string
+	fileMode   os.FileMode
+	fallbackMu sync.Mutex
+	// spilled is whether the fallback file may hold entries.
+	spilled bool
+}
+
+func openPostgresStore(dsn, fallback string, dirMode, fileMode os.FileMode) (*postgresStore, error) {
+	err := os.MkdirAll(filepath.Dir(fallback), dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating fallback directory: %w", err)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables: %w", err)
+	}
+	s := &postgresStore{
+		db:       db,
+		queue:    make(chan Record, postgresQueueSize),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+		fallback: fallback,
+		fileMode: fileMode,
+		spilled:  true,
+	}
+	// Insert what was left over from the last run.
+	if err := s.replay(); err != nil {
+		log.Println("error inserting fallback entries:", err)
+	}
+	go s.insertLoop()
+	return s, nil
+}
+
+func (s *postgresStore) Append(r Record) error {
+	select {
+	case s.queue <- r:
+		return nil
+	default:
+		return s.spill([]Record{r})
+	}
+}
+
+func (s *postgresStore) Close() error {
+	close(s.done)
+	<-s.closed
+	return s.db.Close()
+}
+
+// insertLoop inserts the queued entries until s.done is closed and the queue
+// is empty.
+func (s *postgresStore) insertLoop() {
+	defer close(s.closed)
+	for {
+		batch := s.next()
+		if len(batch) == 0 {
+			return
+		}
+		err := s.insert(batch)
+		if err == nil {
+			// Entries that were spilled because the queue was full are
+			// inserted once it has caught up.
+			if len(s.queue) == 0 && s.hasSpilled() {
+				if err := s.replay(); err != nil {
+					log.Println("error inserting fallback entries:", err)
+				}
+			}
+			continue
+		}
+		log.Println("error inserting entries:", err)
+		if err := s.spill(batch); err != nil {
+			log.Println("error writing fallback entries:", err)
+		}
+		if s.reconnect() {
+			if err := s.replay(); err != nil {
+				log.Println("error inserting fallback entries:", err)
+			}
+		}
+	}
+}
+
+// next waits for the next batch of entries. It returns a short batch once
+// postgresFlushInterval passed since the first entry, and an empty one once
+// s.done is closed and the queue is empty.
+func (s *postgresStore) next() []Record {
+	var batch []Record
+	select {
+	case r := <-s.queue:
+		batch = append(batch, r)
+	case <-s.done:
+		for len(batch) < postgresBatchSize {
+			select {
+			case r := <-s.queue:
+				batch = append(batch, r)
+			default:
+				return batch
+			}
+		}
+		return batch
+	}
+	timer := time.NewTimer(postgresFlushInterval)
+	defer timer.Stop()
+	for len(batch) < postgresBatchSize {
+		select {
+		case r := <-s.queue:
+			batch = append(batch, r)
+		case <-timer.C:
+			return batch
+		case <-s.done:
+			return batch
+		}
+	}
+	return batch
+}
+
+// reconnect waits for the database to come back, backing off between
+// attempts. It gives up and returns false once s.done is closed.
+func (s *postgresStore) reconnect() bool {
+	backoff := time.Second
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			return false
+		}
+		err := s.db.Ping()
+		if err == nil {
+			return true
+		}
+		log.Println("error reconnecting to database:", err)
+		backoff = min(backoff*2, postgresMaxBackoff)
+	}
+}
+
+func (s *postgresStore) insert(records []Record) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO entries
+		(v, type, time, guild, channel, message, author, data, seq)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		_, err := stmt.Exec(
+			r.Entry.Version,
+			string(r.Entry.Type),
+			r.Entry.Time,
+			int64(r.Guild),
+			nullID(uint64(r.Channel)),
+			nullID(uint64(r.Message)),
+			nullID(uint64(r.Author)),
+			string(r.Entry.Data),
+			nullID(r.Entry.Seq),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// spill appends the entries to the fallback file.
+func (s *postgresStore) spill(records []Record) error {
+	s.fallbackMu.Lock()
+	defer s.fallbackMu.Unlock()
+	f, err := os.OpenFile(s.fallback, os.O_WRONLY|os.O_CREATE|os.O_APPEND, s.fileMode)
+	if err != nil {
+		return err
+	}
+	s.spilled = true
+	enc := json.NewEncoder(f)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func (s *postgresStore) hasSpilled() bool {
+	s.fallbackMu.Lock()
+	defer s.fallbackMu.Unlock()
+	return s.spilled
+}
+
+// replay inserts the entries in the fallback file, and removes it if that
+// succeeded.
+func (s *postgresStore) replay() error {
+	s.fallbackMu.Lock()
+	defer s.fallbackMu.Unlock()
+	f, err := os.Open(s.fallback)
+	if os.IsNotExist(err) {
+		s.spilled = false
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return err
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	// Everything goes in one transaction, so that nothing is inserted
+	// twice if it fails midway.
+	if err := s.insert(records); err != nil {
+		return err
+	}
+	if err := os.Remove(s.fallback); err != nil {
+		return err
+	}
+	s.spilled = false
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// fakeDB is a database/sql connector that keeps the guilds of the inserted
+// entries, and accepts any other statement.
+type fakeDB struct {
+	mu       sync.Mutex
+	inserted []discord.GuildID
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (d *fakeDB) guilds() []discord.GuildID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]discord.GuildID(nil), d.inserted...)
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct{ db *fakeDB }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	// The guild is the fourth column of an insert.
+	if len(args) > 3 {
+		s.db.mu.Lock()
+		s.db.inserted = append(s.db.inserted, discord.GuildID(args[3].(int64)))
+		s.db.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestPostgresReplaysSpilledEntries(t *testing.T) {
+	fake := &fakeDB{}
+	s := &postgresStore{
+		db:       sql.OpenDB(fake),
+		queue:    make(chan Record, postgresBatchSize),
+		done:     make(chan struct{}),
+		closed:   make(chan struct{}),
+		fallback: filepath.Join(t.TempDir(), "postgres-fallback.ndjson"),
+		fileMode: 0o644,
+	}
+	// Fill the queue, so that the last entries are spilled.
+	for i := range postgresBatchSize + 2 {
+		if err := s.Append(Record{Guild: discord.GuildID(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(s.fallback); err != nil {
+		t.Fatal("nothing was spilled:", err)
+	}
+	go s.insertLoop()
+	waitFor(t, "the spilled entries were inserted", func() bool {
+		_, err := os.Stat(s.fallback)
+		return os.IsNotExist(err)
+	})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	guilds := fake.guilds()
+	seen := make(map[discord.GuildID]bool)
+	for _, g := range guilds {
+		seen[g] = true
+	}
+	if len(guilds) != postgresBatchSize+2 || len(seen) != len(guilds) {
+		t.Errorf("inserted %d entries, %d of them distinct, want %d", len(guilds), len(seen), postgresBatchSize+2)
+	}
+}
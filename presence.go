@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logPresenceUpdateEvent(p *gateway.PresenceUpdateEvent) {
+	l.trackTag(p.GuildID, p.User)
+	if !l.opts.Presence {
+		return
+	}
+	prev, ok := l.previous(p).(*discord.Presence)
+	if ok && l.opts.PresenceTransitions && prev.Status == p.Status {
+		return
+	}
+	entry := PresenceEntry{
+		User:   User{ID: p.User.ID},
+		Status: p.Status,
+	}
+	// Presence updates only carry the full user if it changed.
+	if p.User.Username != "" {
+		entry.User = toUser(p.User)
+	}
+	if len(p.Activities) > 0 {
+		entry.Activity = p.Activities[0].Name
+	}
+	err := l.appendEntry(p.GuildID, EntryPresence, entry)
+	if err != nil {
+		log.Println("error while logging PresenceUpdateEvent:", err)
+	}
+}
+
+type PresenceEntry struct {
+	User     User           `json:"user"`
+	Status   discord.Status `json:"status"`
+	Activity string         `json:"activity,omitempty"`
+}
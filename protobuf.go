@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// The field numbers and wire types of the Entry message in entry.proto.
+const (
+	pbVersion = 1<<3 | pbVarint
+	pbType    = 2<<3 | pbBytes
+	pbTime    = 3<<3 | pbVarint
+	pbGuild   = 4<<3 | pbFixed64
+	pbData    = 5<<3 | pbBytes
+	pbSeq     = 6<<3 | pbVarint
+
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// encodeProtobuf appends the entry as a protobuf message, prefixed with its
+// length as a varint.
+func encodeProtobuf(buf *bytes.Buffer, e Entry) error {
+	var msg []byte
+	if e.Version != 0 {
+		msg = binary.AppendUvarint(msg, pbVersion)
+		msg = binary.AppendUvarint(msg, uint64(e.Version))
+	}
+	msg = binary.AppendUvarint(msg, pbType)
+	msg = binary.AppendUvarint(msg, uint64(len(e.Type)))
+	msg = append(msg, e.Type...)
+	msg = binary.AppendUvarint(msg, pbTime)
+	msg = binary.AppendUvarint(msg, uint64(e.Time.UnixNano()))
+	if e.Guild.IsValid() {
+		msg = binary.AppendUvarint(msg, pbGuild)
+		msg = binary.LittleEndian.AppendUint64(msg, uint64(e.Guild))
+	}
+	if e.Seq != 0 {
+		msg = binary.AppendUvarint(msg, pbSeq)
+		msg = binary.AppendUvarint(msg, e.Seq)
+	}
+	msg = binary.AppendUvarint(msg, pbData)
+	msg = binary.AppendUvarint(msg, uint64(len(e.Data)))
+	msg = append(msg, e.Data...)
+
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(msg)))])
+	buf.Write(msg)
+	return nil
+}
+
+// decodeProtobuf decodes an entry without its length prefix. Unknown fields
+// are skipped.
+func decodeProtobuf(msg []byte, e *Entry) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("invalid protobuf field")
+		}
+		msg = msg[n:]
+		var v uint64
+		var b []byte
+		switch key & 7 {
+		case pbVarint:
+			v, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return errors.New("invalid protobuf varint")
+			}
+			msg = msg[n:]
+		case pbFixed64:
+			if len(msg) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			v = binary.LittleEndian.Uint64(msg)
+			msg = msg[8:]
+		case pbFixed32:
+			if len(msg) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			msg = msg[4:]
+		case pbBytes:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return errors.New("invalid protobuf length")
+			}
+			b = msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+		switch key {
+		case pbVersion:
+			e.Version = int(v)
+		case pbType:
+			e.Type = EntryType(b)
+		case pbTime:
+			e.Time = time.Unix(0, int64(v)).UTC()
+		case pbGuild:
+			e.Guild = discord.GuildID(v)
+		case pbData:
+			e.Data = b
+		case pbSeq:
+			e.Seq = v
+		}
+	}
+	return nil
+}
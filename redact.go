@@ -0,0 +1,45 @@
+package main
+
+// redactable is implemented by entries that hold the content of messages.
+// redacted returns a copy of the entry with Redacted set and without anything
+// that was written in the message: its content, attachments, embeds,
+// components, mentions and system text. Who sent it and when, and what it
+// replies to, are kept.
+type redactable interface {
+	redacted() interface{}
+}
+
+func (e MessageEntry) redacted() interface{} {
+	e.Content, e.Redacted = "", true
+	e.Attachments, e.Embeds, e.Components = nil, nil, nil
+	e.Mentions, e.System = nil, ""
+	return e
+}
+
+func (e MessageEditEntry) redacted() interface{} {
+	e.Content, e.OldContent, e.Redacted = "", nil, true
+	e.Embeds, e.Components = nil, nil
+	return e
+}
+
+func (e MessageDeleteEntry) redacted() interface{} {
+	if e.Message != nil {
+		m := e.Message.redacted()
+		e.Message = &m
+	}
+	return e
+}
+
+func (e MessageDeleteBulkEntry) redacted() interface{} {
+	messages := make([]CachedMessage, len(e.Messages))
+	for i, m := range e.Messages {
+		messages[i] = m.redacted()
+	}
+	e.Messages = messages
+	return e
+}
+
+func (m CachedMessage) redacted() CachedMessage {
+	m.Content, m.Redacted = "", true
+	return m
+}
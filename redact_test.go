@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestRedactMessage(t *testing.T) {
+	l, st := newTestLogger(t, Options{Filters: Filters{Redact: true}})
+	ev := testMessage(1, 10)
+	ev.Content = "secret <@2>"
+	ev.Mentions = []discord.GuildUser{{User: discord.User{ID: 2, Username: "other"}}}
+	ev.Attachments = []discord.Attachment{{ID: 3, Filename: "secret.png", URL: "https://cdn.example/secret.png"}}
+	ev.Embeds = []discord.Embed{{Title: "secret", Description: "secret"}}
+	ev.Components = discord.ContainerComponents{&discord.ActionRowComponent{
+		&discord.ButtonComponent{Label: "secret", CustomID: "secret", Style: discord.PrimaryButtonStyle()},
+	}}
+	l.HandleEvent(ev)
+	l.Close()
+	entries := st.entries(EntryMessage)
+	if len(entries) != 1 {
+		t.Fatalf("got %d msg entries, want 1", len(entries))
+	}
+	var m MessageEntry
+	if err := json.Unmarshal(entries[0].Data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Redacted {
+		t.Error("entry isn't marked as redacted")
+	}
+	if m.Content != "" || m.Attachments != nil || m.Embeds != nil || m.Components != nil || m.Mentions != nil {
+		t.Errorf("redacted entry still has the message in it: %s", entries[0].Data)
+	}
+	if m.ID != 10 || m.Author.ID != 1 || m.Channel.ID != testChannel {
+		t.Errorf("redacted entry lost who sent the message and where: %s", entries[0].Data)
+	}
+}
+
+func TestRedactSystemText(t *testing.T) {
+	e := MessageEntry{Type: discord.ChannelNameChangeMessage, System: "user changed the channel name to secret"}
+	if got := e.redacted().(MessageEntry); got.System != "" {
+		t.Errorf("redacted entry has system text %q", got.System)
+	}
+}
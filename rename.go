@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// trackTag remembers the user's tag and logs a rename entry if it differs
+// from the last one seen. Users are only compared against tags seen since
+// startup, so nothing is logged the first time a user is seen.
+//
+// Tags are tracked globally, so a rename is only logged to the guild it was
+// first noticed in.
+func (l *Logger) trackTag(gid discord.GuildID, user discord.User) {
+	// Some events, e.g. presence updates, may carry a user with only the ID.
+	if user.Username == "" {
+		return
+	}
+	tag := toUser(user).Tag
+	l.mu.Lock()
+	old, ok := l.tags[user.ID]
+	l.tags[user.ID] = tag
+	l.mu.Unlock()
+	if !ok || old == tag {
+		return
+	}
+	entry := RenameEntry{
+		User:   user.ID,
+		OldTag: old,
+		Tag:    tag,
+	}
+	err := l.appendEntry(gid, EntryRename, entry)
+	if err != nil {
+		log.Println("error while logging rename:", err)
+	}
+}
+
+// RenameEntry is written when a user's username or discriminator changes.
+type RenameEntry struct {
+	User   discord.UserID `json:"user"`
+	OldTag string         `json:"oldTag"`
+	Tag    string         `json:"tag"`
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// pruneInterval is how often expired log files are removed.
+const pruneInterval = 24 * time.Hour
+
+// pruneLoop removes expired log files right away, and then every
+// pruneInterval until fs.done is closed.
+func (fs *fileStore) pruneLoop() {
+	defer fs.loops.Done()
+	fs.prune()
+	t := time.NewTicker(pruneInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			fs.prune()
+		case <-fs.done:
+			return
+		}
+	}
+}
+
+// SetRetention changes the retention periods, which take effect the next
+// time expired files are removed.
+func (fs *fileStore) SetRetention(retention time.Duration, guilds map[discord.GuildID]time.Duration, dryRun bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.opts.Retention, fs.opts.GuildRetention, fs.opts.RetentionDryRun = retention, guilds, dryRun
+}
+
+// prune removes the log files that weren't written to for longer than the
+// retention period, compressed or not, along with directories that are left
+// empty. Open log files are never removed. With RetentionDryRun, the files
+// are only listed. The files of guilds in GuildRetention are kept for as
+// long as that says instead.
+//
+// fs.mu is only held to look at the open files, so that entries can be
+// written while the log directory is walked.
+func (fs *fileStore) prune() {
+	fs.mu.Lock()
+	opts := fs.opts
+	open := fs.openNames()
+	fs.mu.Unlock()
+	if opts.Retention <= 0 && len(opts.GuildRetention) == 0 {
+		return
+	}
+	now := time.Now()
+	guildOf := opts.PathTemplate.guildOf()
+	var dirs []string
+	filepath.WalkDir(fs.path, func(name string, d os.DirEntry, err error) error {
+		if err != nil {
+			log.Println("error while pruning log files:", err)
+			return nil
+		}
+		if d.IsDir() {
+			if name == filepath.Join(fs.path, currentDir) {
+				// The dangling symlinks are removed on startup.
+				return filepath.SkipDir
+			}
+			if name != fs.path {
+				dirs = append(dirs, name)
+			}
+			return nil
+		}
+		if !isLogFile(d.Name()) || open[name] {
+			return nil
+		}
+		// Files that weren't uploaded yet are kept until they are.
+		if fileExists(uploadMarker(strings.TrimSuffix(name, ".gz"))) {
+			return nil
+		}
+		retention := opts.Retention
+		if rel, err := filepath.Rel(fs.path, name); err == nil {
+			if guild, ok := guildOf(filepath.ToSlash(rel)); ok {
+				if r, ok := opts.GuildRetention[guild]; ok {
+					retention = r
+				}
+			}
+		}
+		if retention <= 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(now.Add(-retention)) {
+			return nil
+		}
+		if opts.RetentionDryRun {
+			log.Println("would remove expired log file", name)
+			return nil
+		}
+		fs.removeExpired(name, now.Add(-retention))
+		return nil
+	})
+	if opts.RetentionDryRun {
+		return
+	}
+	// Remove the deepest directories first, so that their parents can
+	// become empty too. Removing a directory that isn't empty fails. fs.mu
+	// is held so that none is removed right before a log file is created
+	// in it.
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
+
+// openNames returns the names of the log files that are open, including the
+// ones that makeRoom closed until they're written to again. It must be called
+// with fs.mu held.
+func (fs *fileStore) openNames() map[string]bool {
+	open := make(map[string]bool)
+	for _, file := range fs.files {
+		open[file.Name()] = true
+	}
+	for _, e := range fs.evicted {
+		open[e.Name] = true
+	}
+	return open
+}
+
+// removeExpired removes the log file that prune found to have expired, unless
+// it was opened or written to since.
+func (fs *fileStore) removeExpired(name string, cutoff time.Time) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.openNames()[name] {
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return
+	}
+	if err := os.Remove(name); err != nil {
+		log.Println("error removing expired log file:", err)
+		return
+	}
+	// The file's truncated marker goes with it, if it has one.
+	os.Remove(truncatedMarker(strings.TrimSuffix(name, ".gz")))
+	log.Println("removed expired log file", name)
+}
+
+// isLogFile returns whether the file is a log file, compressed or not.
+func isLogFile(name string) bool {
+	if name == deadLetterName {
+		return false
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	name = strings.TrimSuffix(name, ".zst")
+	_, ok := formatOf(name)
+	return ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logGuildRoleCreateEvent(r *gateway.GuildRoleCreateEvent) {
+	entry := RoleEntry{
+		Action: ActionCreate,
+		Role:   toRole(r.Role),
+	}
+	err := l.appendEntry(r.GuildID, EntryRole, entry)
+	if err != nil {
+		log.Println("error while logging GuildRoleCreateEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildRoleUpdateEvent(r *gateway.GuildRoleUpdateEvent) {
+	entry := RoleEntry{
+		Action: ActionUpdate,
+		Role:   toRole(r.Role),
+	}
+	if prev, ok := l.previous(r).(*discord.Role); ok {
+		old := toRole(*prev)
+		entry.Old = &old
+	}
+	err := l.appendEntry(r.GuildID, EntryRole, entry)
+	if err != nil {
+		log.Println("error while logging GuildRoleUpdateEvent:", err)
+	}
+}
+
+// The delete event only carries the role's ID, so the rest of the role is
+// filled in from the cache if possible.
+func (l *Logger) logGuildRoleDeleteEvent(r *gateway.GuildRoleDeleteEvent) {
+	entry := RoleEntry{
+		Action: ActionDelete,
+		Role:   Role{ID: r.RoleID},
+	}
+	if prev, ok := l.previous(r).(*discord.Role); ok {
+		entry.Role = toRole(*prev)
+	}
+	err := l.appendEntry(r.GuildID, EntryRole, entry)
+	if err != nil {
+		log.Println("error while logging GuildRoleDeleteEvent:", err)
+	}
+}
+
+func toRole(role discord.Role) Role {
+	return Role{
+		ID:          role.ID,
+		Name:        role.Name,
+		Color:       role.Color,
+		Position:    role.Position,
+		Permissions: role.Permissions,
+	}
+}
+
+// RoleEntry is written when a role is created, updated or deleted. For
+// updates, Old holds the previous version of the role if it was cached.
+type RoleEntry struct {
+	Action Action `json:"action"`
+	Role
+	Old *Role `json:"old,omitempty"`
+}
+
+type Role struct {
+	ID          discord.RoleID      `json:"id"`
+	Name        string              `json:"name,omitempty"`
+	Color       discord.Color       `json:"color"`
+	Position    int                 `json:"position"`
+	Permissions discord.Permissions `json:"permissions"`
+}
@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// Rotation is how often a guild's log file is replaced by a new one. The zero
+// value rotates weekly.
+type Rotation string
+
+const (
+	// RotateWeekly puts log files in a directory per ISO week, e.g. 2024-23.
+	RotateWeekly Rotation = "weekly"
+	// RotateDaily puts log files in a directory per day, e.g. 2024-06-03.
+	RotateDaily Rotation = "daily"
+	// RotateMonthly puts log files in a directory per month, e.g. 2024-06.
+	RotateMonthly Rotation = "monthly"
+)
+
+// template returns the directory that log files go in, as part of a
+// PathTemplate.
+func (r Rotation) template() string {
+	switch r {
+	case RotateDaily:
+		return "{year}-{month}-{day}"
+	case RotateMonthly:
+		return "{year}-{month}"
+	default:
+		return "{year}-{week}"
+	}
+}
+
+// String implements flag.Value.
+func (r Rotation) String() string {
+	if r == "" {
+		return string(RotateWeekly)
+	}
+	return string(r)
+}
+
+// Set implements flag.Value.
+func (r *Rotation) Set(s string) error {
+	switch v := Rotation(s); v {
+	case RotateWeekly, RotateDaily, RotateMonthly:
+		*r = v
+		return nil
+	default:
+		return fmt.Errorf("unknown rotation %q", s)
+	}
+}
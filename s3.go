@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// s3Archive uploads log files to a bucket of an S3-compatible service. The
+// credentials are taken from the standard AWS environment variables.
+type s3Archive struct {
+	endpoint *url.URL
+	bucket   string
+	region   string
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+func newS3Archive(endpoint, bucket string) (*s3Archive, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	a := &s3Archive{
+		endpoint:     u,
+		bucket:       bucket,
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if a.region == "" {
+		a.region = "us-east-1"
+	}
+	if a.accessKey == "" || a.secretKey == "" {
+		return nil, errors.New("no $AWS_ACCESS_KEY_ID or $AWS_SECRET_ACCESS_KEY given")
+	}
+	return a, nil
+}
+
+func (a *s3Archive) String() string {
+	return "s3://" + a.bucket
+}
+
+// upload PUTs the file as the object key, with path-style addressing, which
+// all S3-compatible services understand.
+func (a *s3Archive) upload(ctx context.Context, key, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	u := *a.endpoint
+	u.Path = "/" + a.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	a.sign(req, hex.EncodeToString(h.Sum(nil)), time.Now())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %s: %s: %s", key, resp.Status, body)
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 to the request.
+func (a *s3Archive) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	date := t.Format("20060102")
+	stamp := t.Format("20060102T150405Z")
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if a.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionToken)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if a.sessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n")
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signed, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+a.secretKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, scope, strings.Join(signed, ";"), signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// maxEvents bounds how many scheduled events are remembered.
+const maxEvents = 4096
+
+// rememberEvent keeps the scheduled event for its next update. Events that
+// ended can't change anymore, so they're forgotten.
+func (l *Logger) rememberEvent(e discord.GuildScheduledEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Status == discord.CompletedEvent || e.Status == discord.CancelledEvent {
+		delete(l.events, e.ID)
+		return
+	}
+	if _, ok := l.events[e.ID]; !ok {
+		evictArbitrary(l.events, maxEvents-1)
+	}
+	l.events[e.ID] = e
+}
+
+func (l *Logger) logGuildScheduledEventCreateEvent(e *gateway.GuildScheduledEventCreateEvent) {
+	l.rememberEvent(e.GuildScheduledEvent)
+	entry := l.toScheduledEventEntry(e.GuildScheduledEvent, ActionCreate)
+	err := l.appendEntry(e.GuildID, EntryScheduledEvent, entry)
+	if err != nil {
+		log.Println("error while logging GuildScheduledEventCreateEvent:", err)
+	}
+}
+
+// Scheduled events aren't cached by the state, so the old status is only
+// known if the event was seen before.
+func (l *Logger) logGuildScheduledEventUpdateEvent(e *gateway.GuildScheduledEventUpdateEvent) {
+	entry := l.toScheduledEventEntry(e.GuildScheduledEvent, ActionUpdate)
+	l.mu.Lock()
+	prev, ok := l.events[e.ID]
+	l.mu.Unlock()
+	l.rememberEvent(e.GuildScheduledEvent)
+	if ok && prev.Status != e.Status {
+		entry.OldStatus = eventStatusName(prev.Status)
+	}
+	err := l.appendEntry(e.GuildID, EntryScheduledEvent, entry)
+	if err != nil {
+		log.Println("error while logging GuildScheduledEventUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildScheduledEventDeleteEvent(e *gateway.GuildScheduledEventDeleteEvent) {
+	l.mu.Lock()
+	delete(l.events, e.ID)
+	l.mu.Unlock()
+	entry := l.toScheduledEventEntry(e.GuildScheduledEvent, ActionDelete)
+	err := l.appendEntry(e.GuildID, EntryScheduledEvent, entry)
+	if err != nil {
+		log.Println("error while logging GuildScheduledEventDeleteEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildScheduledEventUserAddEvent(e *gateway.GuildScheduledEventUserAddEvent) {
+	err := l.appendEntry(e.GuildID, EntryRSVP, l.toRSVPEntry(e.GuildID, e.EventID, e.UserID, true))
+	if err != nil {
+		log.Println("error while logging GuildScheduledEventUserAddEvent:", err)
+	}
+}
+
+func (l *Logger) logGuildScheduledEventUserRemoveEvent(e *gateway.GuildScheduledEventUserRemoveEvent) {
+	err := l.appendEntry(e.GuildID, EntryRSVP, l.toRSVPEntry(e.GuildID, e.EventID, e.UserID, false))
+	if err != nil {
+		log.Println("error while logging GuildScheduledEventUserRemoveEvent:", err)
+	}
+}
+
+func (l *Logger) toScheduledEventEntry(e discord.GuildScheduledEvent, action Action) ScheduledEventEntry {
+	entry := ScheduledEventEntry{
+		Action:      action,
+		ID:          e.ID,
+		Name:        e.Name,
+		Description: e.Description,
+		Start:       e.StartTime,
+		End:         optionalTimestamp(e.EndTime),
+		Status:      eventStatusName(e.Status),
+		Interested:  e.UserCount,
+	}
+	if e.ChannelID.IsValid() {
+		ch := l.toChannel(e.ChannelID)
+		entry.Channel = &ch
+	}
+	if e.EntityMetadata != nil {
+		entry.Location = e.EntityMetadata.Location
+	}
+	switch {
+	case e.Creator != nil:
+		creator := toUser(*e.Creator)
+		entry.Creator = &creator
+	case e.CreatorID.IsValid():
+		creator := l.userFromID(e.GuildID, e.CreatorID)
+		entry.Creator = &creator
+	}
+	return entry
+}
+
+func (l *Logger) toRSVPEntry(gid discord.GuildID, eid discord.EventID, uid discord.UserID, interested bool) RSVPEntry {
+	l.mu.Lock()
+	name := l.events[eid].Name
+	l.mu.Unlock()
+	return RSVPEntry{
+		Event:      eid,
+		Name:       name,
+		User:       l.userFromID(gid, uid),
+		Interested: interested,
+	}
+}
+
+func eventStatusName(s discord.EventStatus) string {
+	switch s {
+	case discord.ScheduledEvent:
+		return "scheduled"
+	case discord.ActiveEvent:
+		return "active"
+	case discord.CompletedEvent:
+		return "completed"
+	case discord.CancelledEvent:
+		return "cancelled"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
+
+// ScheduledEventEntry is written when a scheduled event is created, changed,
+// or deleted. Channel is unset for events that take place outside of Discord,
+// which have a Location instead. OldStatus is only set if the status changed.
+type ScheduledEventEntry struct {
+	Action      Action             `json:"action"`
+	ID          discord.EventID    `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Start       discord.Timestamp  `json:"start"`
+	End         *discord.Timestamp `json:"end,omitempty"`
+	Channel     *Channel           `json:"channel,omitempty"`
+	Location    string             `json:"location,omitempty"`
+	Creator     *User              `json:"creator,omitempty"`
+	Status      string             `json:"status"`
+	OldStatus   string             `json:"oldStatus,omitempty"`
+	Interested  int                `json:"interested"`
+}
+
+// RSVPEntry is written when a user marks or unmarks themselves as interested
+// in a scheduled event. Name is only set if the event was seen before.
+type RSVPEntry struct {
+	Event      discord.EventID `json:"event"`
+	Name       string          `json:"name,omitempty"`
+	User       User            `json:"user"`
+	Interested bool            `json:"interested"`
+}
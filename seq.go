@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// sequenceName is the name of the file within the log directory that keeps
+// the guilds' sequence numbers across restarts.
+const sequenceName = "sequence.json"
+
+// sequenceReserve is how many sequence numbers of a guild are reserved at a
+// time. They're saved before an entry with one of them is written, so that no
+// number is written twice if dislog dies. The ones that weren't used are
+// skipped after a restart, so a crash always leaves a gap of up to
+// sequenceReserve numbers, even if no entries were lost.
+const sequenceReserve = 1000
+
+// sequences numbers the entries of every guild, starting at 1. A gap in a
+// guild's numbers means that entries were lost, e.g. because they were
+// dropped or couldn't be written, or that dislog crashed, as described by
+// sequenceReserve. Direct messages are numbered as guild 0.
+type sequences struct {
+	name string
+	mode os.FileMode
+
+	// mu guards last, the last number given out, and is never held while
+	// the file is saved.
+	mu   sync.Mutex
+	last map[discord.GuildID]uint64
+	// saveMu guards saved, the last number that may be written according
+	// to the file.
+	saveMu sync.Mutex
+	saved  map[discord.GuildID]uint64
+}
+
+func loadSequences(dir string, fileMode os.FileMode) (*sequences, error) {
+	s := &sequences{
+		name:  filepath.Join(dir, sequenceName),
+		mode:  fileMode,
+		last:  make(map[discord.GuildID]uint64),
+		saved: make(map[discord.GuildID]uint64),
+	}
+	b, err := os.ReadFile(s.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.saved); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", s.name, err)
+	}
+	for gid, n := range s.saved {
+		s.last[gid] = n
+	}
+	return s, nil
+}
+
+// next returns the guild's next sequence number. It doesn't save the file, so
+// reserve has to be called before the number is written.
+func (s *sequences) next(gid discord.GuildID) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[gid]++
+	return s.last[gid]
+}
+
+// reserve makes sure that the file has the guild's number n reserved, so that
+// it's not given out again after a restart. It's called by the writers,
+// before they write an entry, rather than by next, so that the file isn't
+// saved while the enqueue lock is held.
+func (s *sequences) reserve(gid discord.GuildID, n uint64) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if n <= s.saved[gid] {
+		return nil
+	}
+	prev := s.saved[gid]
+	s.saved[gid] = n - 1 + sequenceReserve
+	if err := s.save(); err != nil {
+		s.saved[gid] = prev
+		return err
+	}
+	return nil
+}
+
+// close saves the last numbers given out, so that they're continued without a
+// gap after a restart. The writers must have stopped.
+func (s *sequences) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	for gid, n := range s.last {
+		s.saved[gid] = n
+	}
+	return s.save()
+}
+
+// save replaces the file with s.saved, atomically and durably. It must be
+// called with s.saveMu held.
+func (s *sequences) save() error {
+	b, err := json.Marshal(s.saved)
+	if err != nil {
+		return err
+	}
+	tmp := s.name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.mode)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err := errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(s.name))
+}
+
+// syncDir syncs the directory, so that files that were renamed in it stay
+// renamed if the system crashes.
+func syncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	return errors.Join(d.Sync(), d.Close())
+}
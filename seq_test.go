@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestSequencesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for want := uint64(1); want <= 3; want++ {
+		n := s.next(1)
+		if n != want {
+			t.Fatalf("got sequence number %d, want %d", n, want)
+		}
+		if err := s.reserve(1, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.next(1); n != 4 {
+		t.Errorf("got sequence number %d after a restart, want 4", n)
+	}
+	if n := s.next(2); n != 1 {
+		t.Errorf("another guild got sequence number %d, want 1", n)
+	}
+}
+
+func TestSequencesCrash(t *testing.T) {
+	dir := t.TempDir()
+	s, err := loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := s.next(1)
+	if _, err := os.Stat(filepath.Join(dir, sequenceName)); err == nil {
+		t.Error("next saved the file, which has to wait until the number is reserved")
+	}
+	if err := s.reserve(1, n); err != nil {
+		t.Fatal(err)
+	}
+	// Without being closed, the numbers carry on after the ones that were
+	// reserved, leaving a gap.
+	s, err = loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.next(1); n != sequenceReserve+1 {
+		t.Errorf("got sequence number %d after a crash, want %d", n, sequenceReserve+1)
+	}
+}
+
+func TestLoggerSequences(t *testing.T) {
+	seqs, err := loadSequences(t.TempDir(), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, st := newTestLogger(t, Options{Sequences: seqs})
+	for id := discord.MessageID(10); id < 13; id++ {
+		l.HandleEvent(testMessage(1, id))
+	}
+	l.Close()
+	entries := st.entries(EntryMessage)
+	if len(entries) != 3 {
+		t.Fatalf("got %d msg entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if want := uint64(i + 1); e.Seq != want {
+			t.Errorf("entry %d has sequence number %d, want %d", i, e.Seq, want)
+		}
+	}
+}
+
+func TestHeldEntriesReserveSequences(t *testing.T) {
+	dir := t.TempDir()
+	seqs, err := loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, st := newTestLogger(t, Options{Sequences: seqs})
+	// Entries that were queued behind one that failed are only written
+	// once writing works again, with numbers past the first reserve.
+	var held []queuedRecord
+	for n := uint64(sequenceReserve); n < sequenceReserve+3; n++ {
+		held = append(held, queuedRecord{r: Record{Guild: 1, Entry: Entry{Type: EntryMessage, Seq: n}}})
+	}
+	if left, err := l.writeHeld(held); err != nil || len(left) != 0 {
+		t.Fatalf("writeHeld left %d entries: %v", len(left), err)
+	}
+	if n := len(st.entries(EntryMessage)); n != 3 {
+		t.Fatalf("got %d msg entries, want 3", n)
+	}
+	// Without being closed, the numbers carry on after the ones that were
+	// written.
+	seqs, err = loadSequences(dir, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := seqs.next(1); n <= sequenceReserve+2 {
+		t.Errorf("got sequence number %d after a crash, which was already written", n)
+	}
+	l.Close()
+}
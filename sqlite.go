@@ -0,0 +1,125 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// sqliteBatchSize is how many entries are inserted per transaction at
+	// most.
+	sqliteBatchSize = 500
+	// sqliteFlushInterval is how often buffered entries are committed.
+	// Entries that weren't committed yet are lost if the process dies.
+	sqliteFlushInterval = time.Second
+)
+
+// sqliteSchema creates the entries table. v is the entry's EntryVersion, and
+// time is in milliseconds since the Unix epoch. The ID columns are NULL for
+// entries they don't apply to. data is the entry's data as JSON. seq is the
+// entry's sequence number, which databases created before it was added get
+// from sqliteAddSeq.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	id      INTEGER PRIMARY KEY,
+	v       INTEGER NOT NULL,
+	type    TEXT NOT NULL,
+	time    INTEGER NOT NULL,
+	guild   INTEGER NOT NULL,
+	channel INTEGER,
+	message INTEGER,
+	author  INTEGER,
+	data    TEXT NOT NULL,
+	seq     INTEGER
+);
+CREATE INDEX IF NOT EXISTS entries_guild_time ON entries (guild, time);
+CREATE INDEX IF NOT EXISTS entries_message ON entries (message) WHERE message IS NOT NULL;
+`
+
+// sqliteAddSeq adds the seq column to databases that don't have it.
+const sqliteAddSeq = `ALTER TABLE entries ADD COLUMN seq INTEGER`
+
+// sqliteStore writes entries to a SQLite database. Entries are buffered and
+// inserted in batches, so that appending doesn't wait for the disk.
+type sqliteStore struct {
+	*batcher
+	db *sql.DB
+}
+
+func openSQLiteStore(name string, dirMode, fileMode os.FileMode) (*sqliteStore, error) {
+	err := os.MkdirAll(filepath.Dir(name), dirMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+	// Create the database file up front, so that it gets fileMode. SQLite
+	// gives its journal files the same mode.
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("error creating database: %w", err)
+	}
+	f.Close()
+	db, err := sql.Open("sqlite3", "file:"+name+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating tables: %w", err)
+	}
+	if _, err := db.Exec(`SELECT seq FROM entries LIMIT 0`); err != nil {
+		if _, err := db.Exec(sqliteAddSeq); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error adding the seq column: %w", err)
+		}
+	}
+	s := &sqliteStore{db: db}
+	s.batcher = newBatcher(sqliteBatchSize, sqliteFlushInterval, s.insert)
+	return s, nil
+}
+
+func (s *sqliteStore) Close() error {
+	return errors.Join(s.batcher.Close(), s.db.Close())
+}
+
+func (s *sqliteStore) insert(records []Record) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO entries
+		(v, type, time, guild, channel, message, author, data, seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range records {
+		_, err := stmt.Exec(
+			r.Entry.Version,
+			string(r.Entry.Type),
+			r.Entry.Time.UnixMilli(),
+			int64(r.Guild),
+			nullID(uint64(r.Channel)),
+			nullID(uint64(r.Message)),
+			nullID(uint64(r.Author)),
+			string(r.Entry.Data),
+			nullID(r.Entry.Seq),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// nullID returns NULL for zero IDs.
+func nullID(id uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/ws"
+)
+
+// arikawa doesn't know about stage instance events, so they are registered
+// here for the gateway to decode.
+func init() {
+	gateway.OpUnmarshalers.Add(
+		func() ws.Event { return new(StageInstanceCreateEvent) },
+		func() ws.Event { return new(StageInstanceUpdateEvent) },
+		func() ws.Event { return new(StageInstanceDeleteEvent) },
+	)
+}
+
+// StageInstance is a live stage in a stage channel.
+type StageInstance struct {
+	ID           discord.StageID   `json:"id"`
+	GuildID      discord.GuildID   `json:"guild_id"`
+	ChannelID    discord.ChannelID `json:"channel_id"`
+	Topic        string            `json:"topic"`
+	PrivacyLevel int               `json:"privacy_level"`
+}
+
+type StageInstanceCreateEvent struct{ StageInstance }
+type StageInstanceUpdateEvent struct{ StageInstance }
+type StageInstanceDeleteEvent struct{ StageInstance }
+
+func (*StageInstanceCreateEvent) Op() ws.OpCode { return 0 }
+func (*StageInstanceUpdateEvent) Op() ws.OpCode { return 0 }
+func (*StageInstanceDeleteEvent) Op() ws.OpCode { return 0 }
+
+func (*StageInstanceCreateEvent) EventType() ws.EventType { return "STAGE_INSTANCE_CREATE" }
+func (*StageInstanceUpdateEvent) EventType() ws.EventType { return "STAGE_INSTANCE_UPDATE" }
+func (*StageInstanceDeleteEvent) EventType() ws.EventType { return "STAGE_INSTANCE_DELETE" }
+
+// maxStages bounds how many stage instances are remembered. Ones whose delete
+// event was missed, e.g. while disconnected, are only forgotten when this is
+// reached or their guild is removed.
+const maxStages = 1024
+
+func (l *Logger) rememberStage(s StageInstance) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.stages[s.ID]; !ok {
+		evictArbitrary(l.stages, maxStages-1)
+	}
+	l.stages[s.ID] = s
+}
+
+func (l *Logger) logStageInstanceCreateEvent(s *StageInstanceCreateEvent) {
+	l.rememberStage(s.StageInstance)
+	err := l.appendEntry(s.GuildID, EntryStage, l.toStageEntry(s.StageInstance, ActionCreate))
+	if err != nil {
+		log.Println("error while logging StageInstanceCreateEvent:", err)
+	}
+}
+
+// Nothing caches stage instances, so the old topic is only known if the
+// stage was seen before.
+func (l *Logger) logStageInstanceUpdateEvent(s *StageInstanceUpdateEvent) {
+	entry := l.toStageEntry(s.StageInstance, ActionUpdate)
+	l.mu.Lock()
+	prev, ok := l.stages[s.ID]
+	l.mu.Unlock()
+	l.rememberStage(s.StageInstance)
+	if ok {
+		entry.OldTopic = &prev.Topic
+	}
+	err := l.appendEntry(s.GuildID, EntryStage, entry)
+	if err != nil {
+		log.Println("error while logging StageInstanceUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logStageInstanceDeleteEvent(s *StageInstanceDeleteEvent) {
+	l.mu.Lock()
+	delete(l.stages, s.ID)
+	l.mu.Unlock()
+	err := l.appendEntry(s.GuildID, EntryStage, l.toStageEntry(s.StageInstance, ActionDelete))
+	if err != nil {
+		log.Println("error while logging StageInstanceDeleteEvent:", err)
+	}
+}
+
+func (l *Logger) toStageEntry(s StageInstance, action Action) StageEntry {
+	return StageEntry{
+		Action:  action,
+		ID:      s.ID,
+		Channel: l.toChannel(s.ChannelID),
+		Topic:   s.Topic,
+		Privacy: stagePrivacyName(s.PrivacyLevel),
+	}
+}
+
+func stagePrivacyName(level int) string {
+	switch level {
+	case 1:
+		return "public"
+	case 2:
+		return "guild"
+	default:
+		return strconv.Itoa(level)
+	}
+}
+
+// StageEntry is written when a stage starts, changes, or ends.
+type StageEntry struct {
+	Action   Action          `json:"action"`
+	ID       discord.StageID `json:"id"`
+	Channel  Channel         `json:"channel"`
+	Topic    string          `json:"topic"`
+	OldTopic *string         `json:"oldTopic,omitempty"`
+	Privacy  string          `json:"privacy"`
+}
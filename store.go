@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// A Store is where a Logger writes its entries to.
+type Store interface {
+	Append(r Record) error
+	// Close writes out anything that is still buffered.
+	Close() error
+}
+
+// A reopener is a Store that keeps files open, which can be closed and
+// opened again, e.g. after they were moved.
+type reopener interface {
+	Reopen() (int, error)
+}
+
+// A retentionSetter is a Store whose retention period can be changed while
+// it's open.
+type retentionSetter interface {
+	SetRetention(retention time.Duration, guilds map[discord.GuildID]time.Duration, dryRun bool)
+}
+
+// Record is an entry along with the IDs it's about, so that stores can index
+// them. IDs that don't apply to the entry are left zero.
+type Record struct {
+	Guild   discord.GuildID
+	Channel discord.ChannelID
+	Message discord.MessageID
+	Author  discord.UserID
+	Entry   Entry
+}
+
+// StoreKind is the kind of Store that entries are written to. The zero value
+// writes them to files.
+type StoreKind string
+
+const (
+	// StoreFile writes entries to log files, as laid out by the path
+	// template.
+	StoreFile StoreKind = "file"
+	// StoreSQLite writes entries to a single SQLite database, dislog.db.
+	StoreSQLite StoreKind = "sqlite"
+	// StorePostgres writes entries to a PostgreSQL database. Entries that
+	// can't be written are kept in postgres-fallback.ndjson until they can.
+	StorePostgres StoreKind = "postgres"
+	// StoreBolt writes entries to a single bbolt database, dislog.bolt.
+	// The dump subcommand writes them back out as ndjson.
+	StoreBolt StoreKind = "bolt"
+)
+
+// String implements flag.Value.
+func (k StoreKind) String() string {
+	if k == "" {
+		return string(StoreFile)
+	}
+	return string(k)
+}
+
+// Set implements flag.Value.
+func (k *StoreKind) Set(s string) error {
+	switch v := StoreKind(s); v {
+	case StoreFile, StoreSQLite, StorePostgres, StoreBolt:
+		*k = v
+		return nil
+	default:
+		return fmt.Errorf("unknown store %q", s)
+	}
+}
+
+// openStore opens the kind of store in the directory path. dsn is only used
+// by StorePostgres.
+func openStore(kind StoreKind, path, dsn string, opts Options) (Store, error) {
+	if opts.DirMode == 0 {
+		opts.DirMode = defaultDirMode
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = defaultFileMode
+	}
+	switch kind {
+	case StoreSQLite:
+		return openSQLiteStore(filepath.Join(path, "dislog.db"), opts.DirMode, opts.FileMode)
+	case StorePostgres:
+		if dsn == "" {
+			return nil, errors.New("no database given")
+		}
+		return openPostgresStore(dsn, filepath.Join(path, "postgres-fallback.ndjson"), opts.DirMode, opts.FileMode)
+	case StoreBolt:
+		return openBoltStore(filepath.Join(path, "dislog.bolt"), opts.DirMode, opts.FileMode)
+	default:
+		return newFileStore(path, opts), nil
+	}
+}
+
+// messageScoped is implemented by entries that are about a single message.
+type messageScoped interface {
+	messageID() discord.MessageID
+}
+
+func (e MessageEntry) messageID() discord.MessageID       { return e.ID }
+func (e MessageEditEntry) messageID() discord.MessageID   { return e.ID }
+func (e MessageDeleteEntry) messageID() discord.MessageID { return e.ID }
+func (e PublishedEntry) messageID() discord.MessageID     { return e.ID }
+func (e ReactionEntry) messageID() discord.MessageID      { return e.MessageID }
+func (e ReactionClearEntry) messageID() discord.MessageID { return e.MessageID }
+func (e ComponentEntry) messageID() discord.MessageID     { return e.Message }
+
+// authored is implemented by entries about something a user did.
+type authored interface {
+	authorID() discord.UserID
+}
+
+func (e MessageEntry) authorID() discord.UserID     { return e.Author.ID }
+func (e MessageEditEntry) authorID() discord.UserID { return e.Author.ID }
+func (e ReactionEntry) authorID() discord.UserID    { return e.User.ID }
+func (e TypingEntry) authorID() discord.UserID      { return e.User.ID }
+func (e CommandEntry) authorID() discord.UserID     { return e.User.ID }
+func (e ComponentEntry) authorID() discord.UserID   { return e.User.ID }
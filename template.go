@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// PathTemplate is the name of a log file relative to the log directory, with
+// placeholders that are filled in for each entry:
+//
+//	{year}    the year, or the ISO year if {week} is used as well
+//	{month}   the month, e.g. 06
+//	{week}    the ISO week, e.g. 23
+//	{day}     the day of the month, e.g. 03
+//	{guild}   the guild's ID, followed by a slug of its name if
+//	          Options.GuildName is set, e.g. 1234-my-server
+//	{channel} the channel's ID, or _guild for entries that aren't about a
+//	          channel
+//
+// A new file is started whenever any of the time placeholders change. If
+// {guild} is left out, all guilds share the same files, which is only allowed
+// with LayoutCombined. The zero value uses the template that -rotation and
+// -layout describe, which is {year}-{week}/{guild}.ndjson by default.
+type PathTemplate string
+
+// templateFields are the placeholders that are allowed in a PathTemplate.
+// The time placeholders are listed first.
+var templateFields = []string{"{year}", "{month}", "{week}", "{day}", "{guild}", "{channel}"}
+
+// String implements flag.Value.
+func (p PathTemplate) String() string {
+	return string(p)
+}
+
+// Set implements flag.Value.
+func (p *PathTemplate) Set(s string) error {
+	if err := validateTemplate(s); err != nil {
+		return fmt.Errorf("invalid path template %q: %w", s, err)
+	}
+	*p = PathTemplate(s)
+	return nil
+}
+
+func validateTemplate(s string) error {
+	if !strings.HasSuffix(s, ".ndjson") {
+		return errors.New("must end in .ndjson")
+	}
+	if strings.HasPrefix(s, "/") {
+		return errors.New("must be relative to the log directory")
+	}
+	for _, elem := range strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return errors.New("must not contain ..")
+		}
+	}
+	rest := s
+	for _, f := range templateFields {
+		rest = strings.ReplaceAll(rest, f, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return errors.New("unknown placeholder")
+	}
+	return nil
+}
+
+// defaultTemplate returns the template that r and layout describe.
+func defaultTemplate(r Rotation, layout Layout) PathTemplate {
+	return PathTemplate(r.template() + "/" + layout.template() + ".ndjson")
+}
+
+func (p PathTemplate) has(field string) bool {
+	return strings.Contains(string(p), field)
+}
+
+// period returns the values of the time placeholders in the template for t.
+// Entries with the same period go in the same file.
+func (p PathTemplate) period(t time.Time) string {
+	var values []string
+	for _, f := range templateFields[:4] {
+		if p.has(f) {
+			values = append(values, p.field(f, t, fileKey{}))
+		}
+	}
+	return strings.Join(values, "-")
+}
+
+// expand returns the name of the file for an entry written at t. guildName
+// is added to the guild's ID, unless it's empty.
+func (p PathTemplate) expand(t time.Time, key fileKey, guildName string) string {
+	name := string(p)
+	for _, f := range templateFields {
+		if p.has(f) {
+			v := p.field(f, t, key)
+			if f == "{guild}" && guildName != "" {
+				v += "-" + guildName
+			}
+			name = strings.ReplaceAll(name, f, v)
+		}
+	}
+	return name
+}
+
+// guildOf returns a function that returns the guild whose log file name is,
+// relative to the log directory and with forward slashes. It returns false if
+// the template has no {guild}, or the name doesn't match the template.
+func (p PathTemplate) guildOf() func(name string) (discord.GuildID, bool) {
+	if !p.has("{guild}") {
+		return func(string) (discord.GuildID, bool) { return 0, false }
+	}
+	expr := regexp.QuoteMeta(strings.TrimSuffix(string(p), ".ndjson"))
+	for _, f := range templateFields {
+		sub := `\d+`
+		switch f {
+		case "{guild}":
+			// The guild's name might follow its ID.
+			sub = `\d+(?:-[^/.]+)?`
+		case "{channel}":
+			sub = `(?:\d+|_guild)`
+		}
+		if f == "{guild}" {
+			// Capture the first one.
+			expr = strings.Replace(expr, regexp.QuoteMeta(f), "("+sub+")", 1)
+		}
+		expr = strings.ReplaceAll(expr, regexp.QuoteMeta(f), sub)
+	}
+	// Files can have a part number and are compressed after the format's
+	// extension.
+	re := regexp.MustCompile("^" + expr + `(?:\.\d+)?\.[a-z]+(?:\.zst)?(?:\.gz)?$`)
+	return func(name string) (discord.GuildID, bool) {
+		m := re.FindStringSubmatch(name)
+		if m == nil {
+			return 0, false
+		}
+		id, _, _ := strings.Cut(m[1], "-")
+		v, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return discord.GuildID(v), true
+	}
+}
+
+func (p PathTemplate) field(f string, t time.Time, key fileKey) string {
+	switch f {
+	case "{year}":
+		if p.has("{week}") {
+			year, _ := t.ISOWeek()
+			return strconv.Itoa(year)
+		}
+		return strconv.Itoa(t.Year())
+	case "{month}":
+		return t.Format("01")
+	case "{week}":
+		_, week := t.ISOWeek()
+		return strconv.Itoa(week)
+	case "{day}":
+		return t.Format("02")
+	case "{guild}":
+		return key.Guild.String()
+	case "{channel}":
+		if !key.Channel.IsValid() {
+			return "_guild"
+		}
+		return key.Channel.String()
+	}
+	return f
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logThreadCreateEvent(t *gateway.ThreadCreateEvent) {
+	err := l.appendEntry(t.GuildID, EntryThread, l.toThreadEntry(t.Channel, ActionCreate))
+	if err != nil {
+		log.Println("error while logging ThreadCreateEvent:", err)
+	}
+}
+
+func (l *Logger) logThreadUpdateEvent(t *gateway.ThreadUpdateEvent) {
+	action := ActionUpdate
+	if prev, ok := l.previous(t).(*discord.Channel); ok {
+		switch {
+		case !archived(*prev) && archived(t.Channel):
+			action = ActionArchive
+		case archived(*prev) && !archived(t.Channel):
+			action = ActionUnarchive
+		}
+	}
+	err := l.appendEntry(t.GuildID, EntryThread, l.toThreadEntry(t.Channel, action))
+	if err != nil {
+		log.Println("error while logging ThreadUpdateEvent:", err)
+	}
+}
+
+func (l *Logger) logThreadDeleteEvent(t *gateway.ThreadDeleteEvent) {
+	// The event only carries the IDs, so fill in the rest from the cache.
+	ch := discord.Channel{
+		ID:       t.ID,
+		GuildID:  t.GuildID,
+		Type:     t.Type,
+		ParentID: t.ParentID,
+	}
+	if prev, ok := l.previous(t).(*discord.Channel); ok {
+		ch = *prev
+	}
+	err := l.appendEntry(t.GuildID, EntryThread, l.toThreadEntry(ch, ActionDelete))
+	if err != nil {
+		log.Println("error while logging ThreadDeleteEvent:", err)
+	}
+}
+
+// logThreadListSyncEvent logs every active thread the current user gained
+// access to, so that messages in them can be resolved later on.
+func (l *Logger) logThreadListSyncEvent(t *gateway.ThreadListSyncEvent) {
+	for _, ch := range t.Threads {
+		err := l.appendEntry(t.GuildID, EntryThread, l.toThreadEntry(ch, ActionSync))
+		if err != nil {
+			log.Println("error while logging ThreadListSyncEvent:", err)
+		}
+	}
+}
+
+func (l *Logger) toThreadEntry(ch discord.Channel, action Action) ThreadEntry {
+	entry := ThreadEntry{
+		Action: action,
+		ID:     ch.ID,
+		Type:   channelTypeName(ch.Type),
+		Name:   ch.Name,
+		Parent: l.toChannel(ch.ParentID),
+	}
+	if ch.OwnerID.IsValid() {
+		creator := l.userFromID(ch.GuildID, ch.OwnerID)
+		entry.Creator = &creator
+	}
+	if md := ch.ThreadMetadata; md != nil {
+		entry.AutoArchive = int(md.AutoArchiveDuration)
+		entry.Archived = md.Archived
+		entry.Locked = md.Locked
+	}
+	parent, err := l.s.Cabinet.Channel(ch.ParentID)
+	if err == nil && parent.Type == discord.GuildForum {
+		// The starter message of a forum post shares the thread's ID.
+		entry.StarterMessage = discord.MessageID(ch.ID)
+		entry.Tags = tagNames(parent.AvailableTags, ch.AppliedTags)
+	}
+	return entry
+}
+
+// tagNames resolves the tag IDs against the forum's available tags. Tags
+// that can't be found are left out.
+func tagNames(available []discord.Tag, applied []discord.TagID) []string {
+	var names []string
+	for _, id := range applied {
+		for _, tag := range available {
+			if tag.ID == id {
+				names = append(names, tag.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func archived(ch discord.Channel) bool {
+	return ch.ThreadMetadata != nil && ch.ThreadMetadata.Archived
+}
+
+// ThreadEntry is written when a thread is created, changed, or deleted, and
+// for every active thread when the thread list is synced. AutoArchive is in
+// minutes. For forum posts, Name is the post's title, and StarterMessage and
+// Tags are set.
+type ThreadEntry struct {
+	Action      Action            `json:"action"`
+	ID          discord.ChannelID `json:"id"`
+	Type        string            `json:"type"`
+	Name        string            `json:"name,omitempty"`
+	Parent      Channel           `json:"parent"`
+	Creator     *User             `json:"creator,omitempty"`
+	AutoArchive int               `json:"autoArchive,omitempty"`
+	Archived    bool              `json:"archived"`
+	Locked      bool              `json:"locked"`
+
+	StarterMessage discord.MessageID `json:"starterMessage,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// typingInterval is the minimum time between two typing entries for the same
+// user in the same channel.
+const typingInterval = 30 * time.Second
+
+type typingKey struct {
+	Channel discord.ChannelID
+	User    discord.UserID
+}
+
+func (l *Logger) logTypingStartEvent(t *gateway.TypingStartEvent) {
+	if !l.opts.Typing || l.ignoresUser(t.UserID, t.Member != nil && t.Member.User.Bot) {
+		return
+	}
+	if !l.typed(typingKey{t.ChannelID, t.UserID}) {
+		return
+	}
+	entry := TypingEntry{
+		User:    User{ID: t.UserID},
+		Channel: Channel{ID: t.ChannelID},
+		Time:    t.Timestamp.Time().UTC(),
+	}
+	err := l.appendEntry(t.GuildID, EntryTyping, entry)
+	if err != nil {
+		log.Println("error while logging TypingStartEvent:", err)
+	}
+}
+
+// typed records that the user started typing in the channel, and returns
+// whether it's been typingInterval since the last time that was logged.
+func (l *Logger) typed(key typingKey) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if last, ok := l.typing[key]; ok && now.Sub(last) < typingInterval {
+		return false
+	}
+	l.typing[key] = now
+	if len(l.typing) > 1024 {
+		for k, last := range l.typing {
+			if now.Sub(last) >= typingInterval {
+				delete(l.typing, k)
+			}
+		}
+	}
+	return true
+}
+
+// TypingEntry is deliberately small since typing indicators are frequent, so
+// only the IDs of the user and channel are recorded.
+type TypingEntry struct {
+	User    User      `json:"user"`
+	Channel Channel   `json:"channel"`
+	Time    time.Time `json:"time"`
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func (l *Logger) logVoiceStateUpdateEvent(v *gateway.VoiceStateUpdateEvent) {
+	entry := VoiceEntry{
+		Mute:     v.Mute,
+		Deaf:     v.Deaf,
+		SelfMute: v.SelfMute,
+		SelfDeaf: v.SelfDeaf,
+	}
+	if v.Member != nil {
+		entry.User = toUser(v.Member.User)
+	} else {
+		entry.User = l.userFromID(v.GuildID, v.UserID)
+	}
+	if v.ChannelID.IsValid() {
+		ch := l.toChannel(v.ChannelID)
+		entry.Channel = &ch
+	}
+	if prev, ok := l.previous(v).(*discord.VoiceState); ok &&
+		prev.ChannelID.IsValid() && prev.ChannelID != v.ChannelID {
+		from := l.toChannel(prev.ChannelID)
+		entry.From = &from
+	}
+	err := l.appendEntry(v.GuildID, EntryVoice, entry)
+	if err != nil {
+		log.Println("error while logging VoiceStateUpdateEvent:", err)
+	}
+	l.trackVoiceSession(v.GuildID, entry.User, entry.Channel)
+}
+
+// voiceSession is the time a user spent in a single voice channel.
+type voiceSession struct {
+	User    User
+	Channel Channel
+	Joined  time.Time
+	// Incomplete is set for sessions that didn't start while we were
+	// watching, so Joined is only when we first saw them.
+	Incomplete bool
+}
+
+// handleGuildCreateEvent remembers the tags of the guild's members and starts
+// sessions for the users that are already in voice channels when the guild
+// becomes available.
+func (l *Logger) handleGuildCreateEvent(g *gateway.GuildCreateEvent) {
+	for _, m := range g.Members {
+		l.trackTag(g.ID, m.User)
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, vs := range g.VoiceStates {
+		if !vs.ChannelID.IsValid() {
+			continue
+		}
+		sessions := l.voiceSessions(g.ID)
+		if _, ok := sessions[vs.UserID]; ok {
+			continue
+		}
+		user := l.userFromID(g.ID, vs.UserID)
+		if vs.Member != nil {
+			user = toUser(vs.Member.User)
+		}
+		sessions[vs.UserID] = &voiceSession{
+			User:       user,
+			Channel:    l.toChannel(vs.ChannelID),
+			Joined:     now,
+			Incomplete: true,
+		}
+	}
+}
+
+// trackVoiceSession ends the user's current session if they left its channel,
+// and starts a new one if they are now in a different channel.
+func (l *Logger) trackVoiceSession(gid discord.GuildID, user User, ch *Channel) {
+	l.mu.Lock()
+	sessions := l.voiceSessions(gid)
+	cur, ok := sessions[user.ID]
+	if ok && ch != nil && cur.Channel.ID == ch.ID {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	delete(sessions, user.ID)
+	if ch != nil {
+		sessions[user.ID] = &voiceSession{
+			User:    user,
+			Channel: *ch,
+			Joined:  now,
+		}
+	}
+	l.mu.Unlock()
+	if ok {
+		l.logVoiceSession(gid, cur, now, cur.Incomplete)
+	}
+}
+
+// voiceSessions returns the guild's sessions. It must be called with l.mu
+// held.
+func (l *Logger) voiceSessions(gid discord.GuildID) map[discord.UserID]*voiceSession {
+	sessions, ok := l.voice[gid]
+	if !ok {
+		sessions = make(map[discord.UserID]*voiceSession)
+		l.voice[gid] = sessions
+	}
+	return sessions
+}
+
+// closeVoiceSessions ends all sessions that are still open, marking them as
+// incomplete since the users haven't actually left yet.
+func (l *Logger) closeVoiceSessions() {
+	now := time.Now()
+	l.mu.Lock()
+	voice := l.voice
+	l.voice = make(map[discord.GuildID]map[discord.UserID]*voiceSession)
+	l.mu.Unlock()
+	for gid, sessions := range voice {
+		for _, session := range sessions {
+			l.logVoiceSession(gid, session, now, true)
+		}
+	}
+}
+
+func (l *Logger) logVoiceSession(gid discord.GuildID, session *voiceSession, left time.Time, incomplete bool) {
+	entry := VoiceSessionEntry{
+		User:       session.User,
+		Channel:    session.Channel,
+		Joined:     session.Joined,
+		Left:       left,
+		Duration:   left.Sub(session.Joined).Seconds(),
+		Incomplete: incomplete,
+	}
+	err := l.appendEntry(gid, EntryVoiceSession, entry)
+	if err != nil {
+		log.Println("error while logging voice session:", err)
+	}
+}
+
+// VoiceEntry is written for every voice state update. Channel is null if the
+// user disconnected. From is set if the user left a channel they were known
+// to be in, either by moving to another one or by disconnecting.
+type VoiceEntry struct {
+	User     User     `json:"user"`
+	Channel  *Channel `json:"channel"`
+	From     *Channel `json:"from,omitempty"`
+	Mute     bool     `json:"mute"`
+	Deaf     bool     `json:"deaf"`
+	SelfMute bool     `json:"selfMute"`
+	SelfDeaf bool     `json:"selfDeaf"`
+}
+
+// VoiceSessionEntry is written when a user leaves a voice channel. Duration
+// is in seconds. Incomplete is set if the session started before or lasted
+// past the time dislog was watching, so Duration is a lower bound.
+type VoiceSessionEntry struct {
+	User       User      `json:"user"`
+	Channel    Channel   `json:"channel"`
+	Joined     time.Time `json:"joined"`
+	Left       time.Time `json:"left"`
+	Duration   float64   `json:"duration"`
+	Incomplete bool      `json:"incomplete,omitempty"`
+}
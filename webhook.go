@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+// The update event doesn't say what changed, so if enrichment is enabled the
+// channel's current webhooks are listed in the entry.
+func (l *Logger) logWebhooksUpdateEvent(w *gateway.WebhooksUpdateEvent) {
+	entry := WebhooksEntry{
+		Channel: l.toChannel(w.ChannelID),
+	}
+	if l.opts.Enrich {
+		l.enrich(w.GuildID, EntryWebhooks, func(s *state.State) interface{} {
+			webhooks, err := s.ChannelWebhooks(w.ChannelID)
+			if err != nil {
+				log.Println("error while fetching webhooks:", err)
+				return entry
+			}
+			entry.Webhooks = make([]Webhook, len(webhooks))
+			for i, wh := range webhooks {
+				entry.Webhooks[i] = toWebhook(wh)
+			}
+			return entry
+		})
+		return
+	}
+	err := l.appendEntry(w.GuildID, EntryWebhooks, entry)
+	if err != nil {
+		log.Println("error while logging WebhooksUpdateEvent:", err)
+	}
+}
+
+// toWebhook leaves out the webhook's token, which would allow anyone reading
+// the logs to post through it.
+func toWebhook(wh discord.Webhook) Webhook {
+	webhook := Webhook{
+		ID:   wh.ID,
+		Name: wh.Name,
+	}
+	if wh.User != nil {
+		creator := toUser(*wh.User)
+		webhook.Creator = &creator
+	}
+	return webhook
+}
+
+// WebhooksEntry is written when a channel's webhooks change. Webhooks is only
+// set if enrichment is enabled and fetching them succeeded.
+type WebhooksEntry struct {
+	Channel  Channel   `json:"channel"`
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+}
+
+type Webhook struct {
+	ID      discord.WebhookID `json:"id"`
+	Name    string            `json:"name"`
+	Creator *User             `json:"creator,omitempty"`
+}
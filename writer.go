@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+const (
+	// defaultWriters is how many goroutines write entries to the store
+	// if Options.Writers isn't set.
+	defaultWriters = 4
+	// defaultQueueSize is how many entries each writer queues if
+	// Options.QueueSize isn't set.
+	defaultQueueSize = 1024
+	// defaultWriteRetries is how many times writing an entry is retried if
+	// -write-retries isn't given.
+	defaultWriteRetries = 3
+	// writeRetryDelay is how long the first retry waits. Every retry after
+	// it waits twice as long as the one before.
+	writeRetryDelay = 100 * time.Millisecond
+	// holdRetryInterval is how often writing the held entries is tried.
+	holdRetryInterval = 10 * time.Second
+	// maxHeld bounds how many entries each writer holds. Once it's
+	// reached, the writer leaves the entries in its queue, so that logging
+	// waits for it, or drops them if Options.DropWhenFull is set.
+	maxHeld = 65536
+)
+
+// WriteFailure is what's done once an entry couldn't be written, even after
+// retrying it.
+type WriteFailure int
+
+const (
+	// HoldOnFailure holds the entry in memory, along with the writer's
+	// entries after it, and keeps trying to write them, e.g. until disk
+	// space was freed up.
+	HoldOnFailure WriteFailure = iota
+	// CrashOnFailure writes the entry to the dead letter file and exits.
+	CrashOnFailure
+)
+
+// String implements flag.Value.
+func (f WriteFailure) String() string {
+	if f == CrashOnFailure {
+		return "crash"
+	}
+	return "hold"
+}
+
+// Set implements flag.Value.
+func (f *WriteFailure) Set(s string) error {
+	switch s {
+	case "hold":
+		*f = HoldOnFailure
+	case "crash":
+		*f = CrashOnFailure
+	default:
+		return fmt.Errorf("unknown write failure policy %q", s)
+	}
+	return nil
+}
+
+// queuedRecord is a record waiting to be written, along with the data of its
+// entry for the dead letter file.
+type queuedRecord struct {
+	r    Record
+	data interface{}
+}
+
+// startWriters starts the goroutines that write entries to the store, so that
+// a slow store doesn't hold up the event loop. Each guild's entries are
+// written by the same one, so that they stay in order.
+func (l *Logger) startWriters() {
+	n, size := l.opts.Writers, l.opts.QueueSize
+	if n <= 0 {
+		n = defaultWriters
+	}
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	l.queues = make([]chan queuedRecord, n)
+	l.queueMu = make([]sync.Mutex, n)
+	l.stopping = make(chan struct{})
+	for i := range l.queues {
+		l.queues[i] = make(chan queuedRecord, size)
+		l.writers.Add(1)
+		go l.writeLoop(l.queues[i])
+	}
+}
+
+// enqueue queues the record to be written. If the guild's queue is full, it
+// waits for room, or drops the record if Options.DropWhenFull is set. The
+// entry's sequence number is taken with the queue locked, so that the numbers
+// are queued in order, and reserved by the writer.
+func (l *Logger) enqueue(r Record, data interface{}) {
+	i := l.writerOf(r.Guild)
+	l.queueMu[i].Lock()
+	defer l.queueMu[i].Unlock()
+	if l.opts.Sequences != nil {
+		r.Entry.Seq = l.opts.Sequences.next(r.Guild)
+	}
+	q := l.queues[i]
+	if !l.opts.DropWhenFull {
+		q <- queuedRecord{r, data}
+		return
+	}
+	select {
+	case q <- queuedRecord{r, data}:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// writeLoop writes the entries from the queue. Once an entry can't be written,
+// it's held along with the ones after it, as described by HoldOnFailure, so
+// that they're still written in order.
+func (l *Logger) writeLoop(q chan queuedRecord) {
+	defer l.writers.Done()
+	var (
+		held  []queuedRecord
+		retry <-chan time.Time
+		stop  = l.stopping
+	)
+	for {
+		in := q
+		if len(held) >= maxHeld && stop != nil {
+			in = nil
+		}
+		select {
+		case <-stop:
+			// Take in the rest of the queue, whatever the limit is, so
+			// that it's seen being closed.
+			stop = nil
+		case qr, ok := <-in:
+			if !ok {
+				l.releaseHeld(held)
+				return
+			}
+			if len(held) > 0 {
+				held = append(held, qr)
+				continue
+			}
+			if err := l.write(qr.r); err != nil {
+				l.writeFailed(qr, err)
+				held = append(held, qr)
+				retry = time.After(holdRetryInterval)
+			}
+		case <-retry:
+			var err error
+			if held, err = l.writeHeld(held); err != nil {
+				log.Printf("still can't write %d held entries: %v", len(held), err)
+				retry = time.After(holdRetryInterval)
+			} else {
+				retry = nil
+			}
+		}
+	}
+}
+
+// reserve reserves the entry's sequence number, which has to be done before
+// it's written.
+func (l *Logger) reserve(r Record) {
+	if l.opts.Sequences != nil && r.Entry.Seq != 0 {
+		if err := l.opts.Sequences.reserve(r.Guild, r.Entry.Seq); err != nil {
+			log.Println("error saving sequence numbers:", err)
+		}
+	}
+}
+
+// write appends the record to the store, retrying it up to
+// Options.WriteRetries times.
+func (l *Logger) write(r Record) error {
+	l.reserve(r)
+	delay := writeRetryDelay
+	for i := 0; ; i++ {
+		err := l.store.Append(r)
+		if err == nil || i >= l.opts.WriteRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// writeFailed counts the entry that couldn't be written, and crashes if
+// Options.OnWriteFailure says so.
+func (l *Logger) writeFailed(qr queuedRecord, err error) {
+	l.failed.Add(1)
+	e := qr.r.Entry
+	if l.opts.OnWriteFailure == CrashOnFailure {
+		l.deadLetter(qr.r.Guild, e, qr.data, err)
+		log.Fatalf("Failed to write %s entry after %d retries: %v", e.Type, l.opts.WriteRetries, err)
+	}
+	log.Printf("failed to write %s entry after %d retries, holding it and the entries after it in memory until writing works again: %v",
+		e.Type, l.opts.WriteRetries, err)
+}
+
+// writeHeld writes the held entries in order, and returns the ones that are
+// still left if writing one of them failed.
+func (l *Logger) writeHeld(held []queuedRecord) ([]queuedRecord, error) {
+	for i, qr := range held {
+		l.reserve(qr.r)
+		if err := l.store.Append(qr.r); err != nil {
+			return held[i:], err
+		}
+	}
+	log.Printf("writing works again, wrote %d held entries", len(held))
+	return nil, nil
+}
+
+// releaseHeld makes the last attempt at writing the held entries when the
+// writer stops, and writes the ones that still fail to the dead letter file.
+func (l *Logger) releaseHeld(held []queuedRecord) {
+	if len(held) == 0 {
+		return
+	}
+	held, err := l.writeHeld(held)
+	if err == nil {
+		return
+	}
+	for _, qr := range held {
+		l.deadLetter(qr.r.Guild, qr.r.Entry, qr.data, err)
+	}
+	log.Printf("couldn't write %d held entries before stopping, they're in the dead letter file: %v", len(held), err)
+}
+
+// stopWriters waits for the queued entries to be written, and stops the
+// writers. Nothing may be queued after it's called.
+func (l *Logger) stopWriters() {
+	close(l.stopping)
+	for _, q := range l.queues {
+		close(q)
+	}
+	l.writers.Wait()
+	if n := l.dropped.Load(); n > 0 {
+		log.Printf("dropped %d entries because the write queues were full", n)
+	}
+	if n := l.failed.Load(); n > 0 {
+		log.Printf("writing entries failed %d times, even after retrying them", n)
+	}
+}
+
+// writerOf returns the index of the writer that writes the guild's entries.
+func (l *Logger) writerOf(id discord.GuildID) int {
+	return int(uint64(id) % uint64(len(l.queues)))
+}